@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	StorageFilesystem = "filesystem"
+	StorageS3         = "s3"
+)
+
+// multipartOverhead leaves room for the multipart framing around the file.
+const multipartOverhead = 64 * 1024
+
+func newATTACHMENT() *ATTACHMENT {
+	return &ATTACHMENT{
+		storage:   getEnv("ATTACHMENT_STORAGE", StorageFilesystem),
+		directory: getEnv("ATTACHMENT_DIRECTORY", "/var/lib/data-platform-conversation/attachments"),
+		maxSize:   int64(getEnvInt("ATTACHMENT_MAX_SIZE_BYTES", 10*1024*1024)),
+		allowedMimeTypes: getEnvStringsWithFallback(
+			"ATTACHMENT_ALLOWED_MIME_TYPES",
+			[]string{
+				"image/jpeg",
+				"image/png",
+				"image/gif",
+				"image/webp",
+				"application/pdf",
+				"text/plain",
+			},
+		),
+		previewMaxDimension: getEnvInt("ATTACHMENT_PREVIEW_MAX_DIMENSION", 320),
+		previewWorkers:      getEnvInt("ATTACHMENT_PREVIEW_WORKERS", 2),
+		unlinkedTTL:         time.Duration(getEnvInt("ATTACHMENT_UNLINKED_TTL_SECONDS", 24*60*60)) * time.Second,
+		s3Endpoint:          os.Getenv("ATTACHMENT_S3_ENDPOINT"),
+		s3Bucket:            os.Getenv("ATTACHMENT_S3_BUCKET"),
+		s3Region:            os.Getenv("ATTACHMENT_S3_REGION"),
+		s3AccessKey:         os.Getenv("ATTACHMENT_S3_ACCESS_KEY"),
+		s3SecretKey:         os.Getenv("ATTACHMENT_S3_SECRET_KEY"),
+		s3UseSSL:            getEnv("ATTACHMENT_S3_USE_SSL", "true") == "true",
+	}
+}
+
+type ATTACHMENT struct {
+	storage          string
+	directory        string
+	maxSize          int64
+	allowedMimeTypes []string
+
+	previewMaxDimension int
+	previewWorkers      int
+	unlinkedTTL         time.Duration
+
+	s3Endpoint  string
+	s3Bucket    string
+	s3Region    string
+	s3AccessKey string
+	s3SecretKey string
+	s3UseSSL    bool
+}
+
+func (c *ATTACHMENT) Storage() string {
+	return c.storage
+}
+func (c *ATTACHMENT) Directory() string {
+	return c.directory
+}
+func (c *ATTACHMENT) MaxSize() int64 {
+	return c.maxSize
+}
+
+// MaxRequestSize caps the whole upload request, file and form included.
+func (c *ATTACHMENT) MaxRequestSize() int64 {
+	return c.maxSize + multipartOverhead
+}
+func (c *ATTACHMENT) PreviewMaxDimension() int {
+	return c.previewMaxDimension
+}
+func (c *ATTACHMENT) PreviewWorkers() int {
+	return c.previewWorkers
+}
+
+// UnlinkedTTL is how long an upload may wait to be sent with a message
+// before it is deleted.
+func (c *ATTACHMENT) UnlinkedTTL() time.Duration {
+	return c.unlinkedTTL
+}
+func (c *ATTACHMENT) S3Endpoint() string {
+	return c.s3Endpoint
+}
+func (c *ATTACHMENT) S3Bucket() string {
+	return c.s3Bucket
+}
+func (c *ATTACHMENT) S3Region() string {
+	return c.s3Region
+}
+func (c *ATTACHMENT) S3AccessKey() string {
+	return c.s3AccessKey
+}
+func (c *ATTACHMENT) S3SecretKey() string {
+	return c.s3SecretKey
+}
+func (c *ATTACHMENT) S3UseSSL() bool {
+	return c.s3UseSSL
+}
+
+func (c *ATTACHMENT) IsAllowedMimeType(mimeType string) bool {
+	for _, allowed := range c.allowedMimeTypes {
+		if strings.EqualFold(allowed, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnvStringsWithFallback(key string, fallback []string) []string {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+	return getEnvStrings(key)
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+func newAUTH() *AUTH {
+	return &AUTH{
+		hs256Secret:          os.Getenv("JWT_HS256_SECRET"),
+		rs256PublicKey:       os.Getenv("JWT_RS256_PUBLIC_KEY"),
+		rs256PublicKeyPath:   os.Getenv("JWT_RS256_PUBLIC_KEY_PATH"),
+		businessPartnerClaim: getEnv("JWT_BUSINESS_PARTNER_CLAIM", "business_partner"),
+
+		adminBusinessPartners: getEnvInts("ADMIN_BUSINESS_PARTNERS"),
+	}
+}
+
+type AUTH struct {
+	hs256Secret          string
+	rs256PublicKey       string
+	rs256PublicKeyPath   string
+	businessPartnerClaim string
+
+	adminBusinessPartners []int
+}
+
+func (c *AUTH) HS256Secret() []byte {
+	if c.hs256Secret == "" {
+		return nil
+	}
+	return []byte(c.hs256Secret)
+}
+
+// RS256PublicKey returns the PEM encoded public key, read from
+// JWT_RS256_PUBLIC_KEY or else from the file at JWT_RS256_PUBLIC_KEY_PATH.
+func (c *AUTH) RS256PublicKey() ([]byte, error) {
+	if c.rs256PublicKey != "" {
+		return []byte(c.rs256PublicKey), nil
+	}
+	if c.rs256PublicKeyPath == "" {
+		return nil, nil
+	}
+	return os.ReadFile(c.rs256PublicKeyPath)
+}
+
+func (c *AUTH) BusinessPartnerClaim() string {
+	return c.businessPartnerClaim
+}
+
+// AdminBusinessPartners may use the admin endpoints.
+func (c *AUTH) AdminBusinessPartners() []int {
+	return c.adminBusinessPartners
+}
+
+func getEnvInts(key string) []int {
+	var vals []int
+	for _, rawVal := range getEnvStrings(key) {
+		if rawVal == "" {
+			continue
+		}
+		val, err := strconv.Atoi(rawVal)
+		if err != nil {
+			continue
+		}
+		vals = append(vals, val)
+	}
+	return vals
+}
@@ -1,15 +1,35 @@
 package config
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 type REDIS struct {
-	Address string
-	Port    string
+	Address  string
+	Port     string
+	Password string
+	DB       int
 }
 
 func newREDIS() *REDIS {
 	return &REDIS{
-		Address: os.Getenv("REDIS_HOST"),
-		Port:    os.Getenv("REDIS_PORT"),
+		Address:  os.Getenv("REDIS_HOST"),
+		Port:     os.Getenv("REDIS_PORT"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       getEnvInt("REDIS_DB", 0),
 	}
 }
+
+func (c *REDIS) URL() string {
+	if c.Port == "" {
+		return fmt.Sprintf("%s:6379", c.Address)
+	}
+	return fmt.Sprintf("%s:%s", c.Address, c.Port)
+}
+
+// Enabled reports whether a Redis host is configured. Without one the
+// service runs as a single node and keeps everything in memory.
+func (c *REDIS) Enabled() bool {
+	return c.Address != ""
+}
@@ -7,20 +7,26 @@ import (
 )
 
 type Conf struct {
-	RMQ     *RMQ
-	REDIS   *REDIS
-	SERVER  *SERVER
-	REQUEST *REQUEST
-	DB      *Database
+	RMQ        *RMQ
+	REDIS      *REDIS
+	SERVER     *SERVER
+	REQUEST    *REQUEST
+	DB         *Database
+	AUTH       *AUTH
+	MESSAGE    *MESSAGE
+	ATTACHMENT *ATTACHMENT
 }
 
 func NewConf() *Conf {
 	return &Conf{
-		RMQ:     newRMQ(),
-		REDIS:   newREDIS(),
-		SERVER:  newSERVER(),
-		REQUEST: newREQUEST(),
-		DB:      newDatabase(),
+		RMQ:        newRMQ(),
+		REDIS:      newREDIS(),
+		SERVER:     newSERVER(),
+		REQUEST:    newREQUEST(),
+		DB:         newDatabase(),
+		AUTH:       newAUTH(),
+		MESSAGE:    newMESSAGE(),
+		ATTACHMENT: newATTACHMENT(),
 	}
 }
 
@@ -34,6 +40,9 @@ func getEnv(key, fallback string) string {
 
 func getEnvInt(key string, fallback int) int {
 	rawVal := os.Getenv(key)
+	if rawVal == "" {
+		return fallback
+	}
 	val, err := strconv.Atoi(rawVal)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "environment %s required number type: %+v", key, err)
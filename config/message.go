@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+func newMESSAGE() *MESSAGE {
+	return &MESSAGE{
+		editWindow: time.Duration(getEnvInt("MESSAGE_EDIT_WINDOW_SECONDS", 15*60)) * time.Second,
+	}
+}
+
+type MESSAGE struct {
+	editWindow time.Duration
+}
+
+// EditWindow is how long after sending a message its sender may edit it.
+func (c *MESSAGE) EditWindow() time.Duration {
+	return c.editWindow
+}
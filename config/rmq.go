@@ -16,12 +16,14 @@ func newRMQ() *RMQ {
 		queueFrom:     os.Getenv("RMQ_QUEUE_FROM"),
 		queueToSQL:    getEnvStrings("RMQ_QUEUE_TO_SQL"),
 		queueToExConf: getEnvStrings("RMQ_QUEUE_TO_EX_CONF"),
+		queueToEvents: getEnvStrings("RMQ_QUEUE_TO_EVENTS"),
 		queueToSubFunc: map[string]string{
 			"Headers": os.Getenv("RMQ_QUEUE_TO_HEADERS_SUB_FUNC"),
 			"Items":   os.Getenv("RMQ_QUEUE_TO_ITEMS_SUB_FUNC"),
 		},
 		queueToResponse:     os.Getenv("NESTJS_DATA_CONNECTION_REQUEST_CONTROL_MANAGER_CONSUME"),
 		sessionControlQueue: os.Getenv("RMQ_SESSION_CONTROL_QUEUE"),
+		queueDeadLetter:     os.Getenv("RMQ_QUEUE_DEAD_LETTER"),
 	}
 }
 
@@ -35,6 +37,8 @@ type RMQ struct {
 	queueFrom       string
 	queueToSQL      []string
 	queueToExConf   []string
+	queueToEvents   []string
+	queueDeadLetter string
 	queueToSubFunc  map[string]string
 	queueToResponse string
 
@@ -64,6 +68,29 @@ func (c *RMQ) QueueToResponse() string {
 	return c.queueToResponse
 }
 
+// QueueToEvents lists the queues that receive conversation events.
+func (c *RMQ) QueueToEvents() []string {
+	queues := make([]string, 0, len(c.queueToEvents))
+	for _, queue := range c.queueToEvents {
+		if queue != "" {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// QueueDeadLetter receives commands from QueueFrom that can never be
+// processed. When empty they are rejected and left to the broker's
+// dead-letter exchange.
+func (c *RMQ) QueueDeadLetter() string {
+	return c.queueDeadLetter
+}
+
+// Enabled reports whether a RabbitMQ host is configured.
+func (c *RMQ) Enabled() bool {
+	return c.addr != ""
+}
+
 func getEnvStrings(key string) []string {
 	rawVal := os.Getenv(key)
 	rawVal = strings.ReplaceAll(rawVal, "\\ ", "$THIS_SECTION_IS_SPACE")
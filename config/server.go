@@ -3,20 +3,52 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 func newSERVER() *SERVER {
-	return &SERVER{
-		host: os.Getenv("SERVER_HOST"),
-		port: os.Getenv("SERVER_PORT"),
+	s := &SERVER{
+		host:         os.Getenv("SERVER_HOST"),
+		port:         os.Getenv("SERVER_PORT"),
+		pingInterval: time.Duration(getEnvInt("WS_PING_INTERVAL_SECONDS", 30)) * time.Second,
+		pongWait:     time.Duration(getEnvInt("WS_PONG_WAIT_SECONDS", 60)) * time.Second,
+		maxIdle:      time.Duration(getEnvInt("WS_MAX_IDLE_SECONDS", 30*60)) * time.Second,
 	}
+	if s.pongWait <= 0 {
+		s.pongWait = 60 * time.Second
+	}
+	// A ping has to go out before the pong deadline of the previous one.
+	if s.pingInterval <= 0 || s.pingInterval >= s.pongWait {
+		s.pingInterval = s.pongWait * 9 / 10
+	}
+	return s
 }
 
 type SERVER struct {
-	host string
-	port string
+	host         string
+	port         string
+	pingInterval time.Duration
+	pongWait     time.Duration
+	maxIdle      time.Duration
 }
 
 func (c *SERVER) ServerURL() string {
 	return fmt.Sprintf("%s:%s", c.host, c.port)
 }
+
+// PingInterval is how often websocket connections are pinged.
+func (c *SERVER) PingInterval() time.Duration {
+	return c.pingInterval
+}
+
+// PongWait is how long a websocket connection may stay silent, pongs
+// included, before it is considered dead.
+func (c *SERVER) PongWait() time.Duration {
+	return c.pongWait
+}
+
+// MaxIdle is how long a websocket connection may go without sending any
+// message before it is closed. Zero disables the limit.
+func (c *SERVER) MaxIdle() time.Duration {
+	return c.maxIdle
+}
@@ -0,0 +1,59 @@
+package controllersMessageAdminOutbox
+
+import (
+	"data-platform-conversation-kube/api-input-reader/types"
+	"data-platform-conversation-kube/services"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"net/http"
+)
+
+const (
+	DefaultOutboxEventsLimit = 50
+	MaxOutboxEventsLimit     = 500
+)
+
+type MessageAdminOutboxController struct {
+	beego.Controller
+	UserInfo     *types.Request
+	CustomLogger *logger.Logger
+	Store        services.ConversationStore
+}
+
+func (controller *MessageAdminOutboxController) Get() {
+	badRequest := http.StatusBadRequest
+
+	controller.UserInfo = services.UserRequestParams(
+		services.RequestWrapperController{
+			Controller:   &controller.Controller,
+			CustomLogger: controller.CustomLogger,
+		},
+	)
+
+	limit, err := controller.GetInt("limit", DefaultOutboxEventsLimit)
+	if err != nil || limit < 1 || limit > MaxOutboxEventsLimit {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.Errorf("limit must be between 1 and %d", MaxOutboxEventsLimit),
+			&badRequest,
+		)
+		return
+	}
+
+	backlog, err := controller.Store.ReadOutboxBacklog(limit)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadOutboxBacklog error")
+		return
+	}
+
+	controller.Data["json"] = map[string]interface{}{
+		"Outbox": backlog,
+	}
+	controller.ServeJSON()
+}
@@ -0,0 +1,88 @@
+package controllersMessageAdminOutbox
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestHandler(t *testing.T) (*beego.ControllerRegister, *services.MemoryStore) {
+	t.Helper()
+
+	store := services.NewMemoryStore()
+	handler := beego.NewControllerRegister()
+	handler.Add("/admin/outbox", &MessageAdminOutboxController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+	})
+	return handler, store
+}
+
+func get(t *testing.T, handler http.Handler, query string) (int, typesMessage.OutboxBacklog) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/outbox?"+query, nil))
+
+	var response struct {
+		Outbox typesMessage.OutboxBacklog
+	}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response.Outbox
+}
+
+func TestGetReportsPendingEvents(t *testing.T) {
+	handler, store := newTestHandler(t)
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		_, _, err := store.InsertConversationHistory(
+			*chatRoom,
+			1001,
+			typesMessage.SenderTypeBusinessPartner,
+			fmt.Sprintf("m%d", i),
+			"hello",
+			time.Now().Format("2006-01-02 15:04:05.999999"),
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, backlog := get(t, handler, "limit=1")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if backlog.Pending != 3 || backlog.Retrying != 0 || backlog.OldestPendingAt == nil {
+		t.Errorf("backlog = %+v, want RoomCreated and two MessageSent pending", backlog)
+	}
+	if len(backlog.Events) != 1 || backlog.Events[0].EventType != servicesEvents.RoomCreated || backlog.Events[0].ChatRoom != *chatRoom {
+		t.Errorf("events = %+v, want the RoomCreated of %s first", backlog.Events, *chatRoom)
+	}
+}
+
+func TestGetRejectsInvalidLimit(t *testing.T) {
+	handler, _ := newTestHandler(t)
+
+	for _, query := range []string{"limit=0", fmt.Sprintf("limit=%d", MaxOutboxEventsLimit+1), "limit=all"} {
+		if status, _ := get(t, handler, query); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+}
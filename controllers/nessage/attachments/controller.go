@@ -0,0 +1,208 @@
+package controllersMessageAttachments
+
+import (
+	"bytes"
+	"data-platform-conversation-kube/api-input-reader/types"
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	servicesPreview "data-platform-conversation-kube/services/preview"
+	servicesStorage "data-platform-conversation-kube/services/storage"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"errors"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/google/uuid"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sniffLength is how many bytes http.DetectContentType looks at.
+const sniffLength = 512
+
+type MessageAttachmentsController struct {
+	beego.Controller
+	UserInfo       *types.Request
+	CustomLogger   *logger.Logger
+	Store          services.ConversationStore
+	Storage        servicesStorage.Storage
+	AttachmentConf *config.ATTACHMENT
+	Preview        *servicesPreview.Worker
+}
+
+func (controller *MessageAttachmentsController) Post() {
+	chatRoom := controller.GetString(":chatRoom")
+
+	controller.UserInfo = services.UserRequestParams(
+		services.RequestWrapperController{
+			Controller:   &controller.Controller,
+			CustomLogger: controller.CustomLogger,
+		},
+	)
+
+	tooLarge := http.StatusRequestEntityTooLarge
+	tooLargeErr := xerrors.Errorf("attachment exceeds %d bytes", controller.AttachmentConf.MaxSize())
+
+	// The body is capped by LimitRequestBodyFilter, so an oversized upload
+	// fails while beego parses the form.
+	file, header, err := controller.GetFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		services.HandleError(&controller.Controller, tooLargeErr, &tooLarge)
+		return
+	} else if err != nil {
+		badRequest := http.StatusBadRequest
+		services.HandleError(&controller.Controller, err, &badRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > controller.AttachmentConf.MaxSize() {
+		services.HandleError(&controller.Controller, tooLargeErr, &tooLarge)
+		return
+	}
+
+	// The MIME type is sniffed from the content rather than trusted from the
+	// client.
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		services.HandleError(&controller.Controller, err, nil)
+		return
+	}
+	head = head[:n]
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !controller.AttachmentConf.IsAllowedMimeType(mimeType) {
+		unsupported := http.StatusUnsupportedMediaType
+		services.HandleError(
+			&controller.Controller,
+			xerrors.Errorf("attachment type %s is not allowed", mimeType),
+			&unsupported,
+		)
+		return
+	}
+
+	attachmentID := uuid.New().String()
+	attachment := typesMessage.Attachment{
+		AttachmentID: attachmentID,
+		ChatRoom:     chatRoom,
+		Uploader:     *controller.UserInfo.BusinessPartner,
+		FileName:     filepath.Base(header.Filename),
+		MimeType:     mimeType,
+		Size:         header.Size,
+		StorageKey:   fmt.Sprintf("%s/%s", chatRoom, attachmentID),
+		CreatedAt:    time.Now().Format("2006-01-02 15:04:05.999999"),
+		URL:          services.AttachmentURL(chatRoom, attachmentID),
+	}
+
+	err = controller.Storage.Put(
+		attachment.StorageKey,
+		io.MultiReader(bytes.NewReader(head), file),
+		attachment.Size,
+		attachment.MimeType,
+	)
+	if err != nil {
+		services.HandleError(&controller.Controller, err, nil)
+		controller.CustomLogger.Error("Storage.Put error")
+		return
+	}
+
+	err = controller.Store.InsertAttachment(attachment)
+	if err != nil {
+		if deleteErr := controller.Storage.Delete(attachment.StorageKey); deleteErr != nil {
+			controller.CustomLogger.Error("Storage.Delete error: %v", deleteErr)
+		}
+		services.HandleError(&controller.Controller, err, nil)
+		controller.CustomLogger.Error("InsertAttachment error")
+		return
+	}
+
+	controller.Preview.Enqueue(attachment)
+
+	controller.Data["json"] = map[string]interface{}{
+		"Attachment": attachment,
+	}
+	controller.ServeJSON()
+}
+
+func (controller *MessageAttachmentsController) Download() {
+	chatRoom := controller.GetString(":chatRoom")
+	attachmentID := controller.GetString(":attachment")
+
+	attachment, err := controller.Store.ReadAttachment(chatRoom, attachmentID)
+	if errors.Is(err, services.ErrAttachmentMissing) {
+		notFound := http.StatusNotFound
+		services.HandleError(&controller.Controller, err, &notFound)
+		return
+	} else if err != nil {
+		services.HandleError(&controller.Controller, err, nil)
+		controller.CustomLogger.Error("ReadAttachment error")
+		return
+	}
+
+	controller.serveObject(attachment.StorageKey, attachment.MimeType, attachment.FileName)
+}
+
+func (controller *MessageAttachmentsController) DownloadPreview() {
+	chatRoom := controller.GetString(":chatRoom")
+	attachmentID := controller.GetString(":attachment")
+	notFound := http.StatusNotFound
+
+	attachment, err := controller.Store.ReadAttachment(chatRoom, attachmentID)
+	if errors.Is(err, services.ErrAttachmentMissing) {
+		services.HandleError(&controller.Controller, err, &notFound)
+		return
+	} else if err != nil {
+		services.HandleError(&controller.Controller, err, nil)
+		controller.CustomLogger.Error("ReadAttachment error")
+		return
+	}
+	if attachment.PreviewStorageKey == nil || attachment.PreviewMimeType == nil {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("preview is not available"),
+			&notFound,
+		)
+		return
+	}
+
+	controller.serveObject(
+		*attachment.PreviewStorageKey,
+		*attachment.PreviewMimeType,
+		"preview-"+attachment.FileName,
+	)
+}
+
+func (controller *MessageAttachmentsController) serveObject(
+	storageKey string,
+	mimeType string,
+	fileName string,
+) {
+	body, err := controller.Storage.Get(storageKey)
+	if errors.Is(err, servicesStorage.ErrObjectNotFound) {
+		notFound := http.StatusNotFound
+		services.HandleError(&controller.Controller, err, &notFound)
+		return
+	} else if err != nil {
+		services.HandleError(&controller.Controller, err, nil)
+		controller.CustomLogger.Error("Storage.Get error")
+		return
+	}
+	defer body.Close()
+
+	output := controller.Ctx.Output
+	output.Header("Content-Type", mimeType)
+	output.Header("Content-Disposition", mime.FormatMediaType(
+		"inline",
+		map[string]string{"filename": strings.ReplaceAll(fileName, "\"", "")},
+	))
+	output.Header("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(controller.Ctx.ResponseWriter, body); err != nil {
+		controller.CustomLogger.Error("Failed to stream attachment: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package controllersMessageAttachments
+
+import (
+	"bytes"
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	servicesPreview "data-platform-conversation-kube/services/preview"
+	servicesStorage "data-platform-conversation-kube/services/storage"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const maxSize = 1024
+
+type testServer struct {
+	handler  *beego.ControllerRegister
+	store    *services.MemoryStore
+	chatRoom string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	t.Setenv("ATTACHMENT_MAX_SIZE_BYTES", strconv.Itoa(maxSize))
+	t.Setenv("ATTACHMENT_DIRECTORY", t.TempDir())
+	conf := config.NewConf()
+
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := servicesStorage.NewFilesystemStorage(conf.ATTACHMENT.Directory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logger.NewLogger()
+
+	controller := &MessageAttachmentsController{
+		CustomLogger:   l,
+		Store:          store,
+		Storage:        storage,
+		AttachmentConf: conf.ATTACHMENT,
+		Preview:        servicesPreview.NewWorker(store, storage, l, conf.ATTACHMENT.PreviewMaxDimension()),
+	}
+	handler := beego.NewControllerRegister()
+	handler.Add("/attachments/:chatRoom", controller, "post:Post")
+	handler.Add("/attachments/:chatRoom/:attachment", controller, "get:Download")
+	handler.InsertFilter(
+		"/attachments/:chatRoom",
+		beego.BeforeStatic,
+		services.LimitRequestBodyFilter(conf.ATTACHMENT.MaxRequestSize()),
+	)
+
+	return &testServer{
+		handler:  handler,
+		store:    store,
+		chatRoom: *chatRoom,
+	}
+}
+
+// countingReader counts the bytes the server read from the request body.
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func (s *testServer) upload(t *testing.T, businessPartner int, content []byte) *httptest.ResponseRecorder {
+	recorder, _ := s.uploadCounting(t, businessPartner, content)
+	return recorder
+}
+
+// uploadCounting uploads content and also returns how many bytes of the
+// request body were read.
+func (s *testServer) uploadCounting(t *testing.T, businessPartner int, content []byte) (*httptest.ResponseRecorder, int) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "note.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &countingReader{reader: &body}
+	request := httptest.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("/attachments/%s?businessPartner=%d", s.chatRoom, businessPartner),
+		counting,
+	)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(recorder, request)
+	return recorder, counting.read
+}
+
+func (s *testServer) download(t *testing.T, attachmentID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("/attachments/%s/%s", s.chatRoom, attachmentID),
+		nil,
+	)
+	recorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func uploadedAttachmentID(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("upload status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Attachment struct {
+			AttachmentID string
+		}
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Attachment.AttachmentID == "" {
+		t.Fatalf("upload returned no attachment: %s", recorder.Body)
+	}
+	return response.Attachment.AttachmentID
+}
+
+func TestPostAndDownload(t *testing.T) {
+	server := newTestServer(t)
+	content := []byte("hello, attachments")
+
+	attachmentID := uploadedAttachmentID(t, server.upload(t, 1001, content))
+
+	recorder := server.download(t, attachmentID)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("download status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), content) {
+		t.Errorf("download body = %q, want %q", recorder.Body.Bytes(), content)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+}
+
+func TestPostRejectsOversizedFile(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.upload(t, 1001, bytes.Repeat([]byte("a"), maxSize+1))
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+// An upload far beyond the limit is cut off while beego parses the form,
+// before the controller runs.
+func TestPostRejectsOversizedRequest(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder, read := server.uploadCounting(t, 1001, bytes.Repeat([]byte("a"), 1024*1024))
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusRequestEntityTooLarge)
+	}
+	if limit := config.NewConf().ATTACHMENT.MaxRequestSize(); int64(read) > limit+32*1024 {
+		t.Errorf("read %d bytes of the body, want the limit of %d", read, limit)
+	}
+}
+
+func TestPostRejectsDisallowedType(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.upload(t, 1001, []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestDownloadUnknownAttachment(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.download(t, "unknown")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestDownloadOfDeletedMessage(t *testing.T) {
+	server := newTestServer(t)
+	attachmentID := uploadedAttachmentID(t, server.upload(t, 1001, []byte("to be deleted")))
+
+	sentAt := time.Now().Format("2006-01-02 15:04:05.999999")
+	_, _, err := server.store.InsertConversationHistory(
+		server.chatRoom, 1001,
+		typesMessage.SenderTypeBusinessPartner,
+		"message-1", "see attached",
+		sentAt,
+		nil,
+		[]string{attachmentID},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := server.download(t, attachmentID); recorder.Code != http.StatusOK {
+		t.Fatalf("status before deletion = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	err = server.store.DeleteMessageForEveryone(server.chatRoom, "message-1", 1001, sentAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := server.download(t, attachmentID); recorder.Code != http.StatusNotFound {
+		t.Fatalf("status after deletion = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
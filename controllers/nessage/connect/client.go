@@ -0,0 +1,228 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"golang.org/x/xerrors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// clientQueueSize bounds the events waiting to be written to one
+	// connection. A client that falls this far behind is disconnected.
+	clientQueueSize = 256
+	// writeWait is the time allowed to write one event to the connection.
+	writeWait = 10 * time.Second
+)
+
+var (
+	errClientClosed = xerrors.New("connection is closed")
+	errSlowConsumer = xerrors.New("connection fell behind and was closed")
+	errIdleTimeout  = xerrors.New("connection was idle for too long")
+)
+
+// client is one websocket connection of a business partner to a room. All
+// writes go through its queue and a single writer goroutine, since
+// gorilla/websocket allows only one concurrent writer per connection.
+type client struct {
+	ws        *websocket.Conn
+	queue     chan outboundEvent
+	done      chan struct{}
+	closeOnce sync.Once
+
+	pingInterval time.Duration
+	pongWait     time.Duration
+	maxIdle      time.Duration
+	// lastActiveAt is the UnixNano time of the last message read from the
+	// client; pongs do not count.
+	lastActiveAt atomic.Int64
+
+	// While replaying, live events are held back in pending so that missed
+	// messages reach the client before anything published after it joined.
+	mu        sync.Mutex
+	replaying bool
+	pending   []pendingEvent
+}
+
+type outboundEvent struct {
+	payload []byte
+	// written is called by the writer once the payload is on the wire.
+	written func()
+}
+
+type pendingEvent struct {
+	payload         []byte
+	receivedMessage *receivedMessage
+}
+
+func newClient(ws *websocket.Conn, replaying bool, serverConf *config.SERVER) *client {
+	c := &client{
+		ws:           ws,
+		queue:        make(chan outboundEvent, clientQueueSize),
+		done:         make(chan struct{}),
+		pingInterval: serverConf.PingInterval(),
+		pongWait:     serverConf.PongWait(),
+		maxIdle:      serverConf.MaxIdle(),
+		replaying:    replaying,
+	}
+	c.touch()
+
+	// Any frame read from the client, pongs included, proves the connection
+	// is alive. A half-open connection fails its next read at the deadline.
+	ws.SetReadDeadline(time.Now().Add(c.pongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(c.pongWait))
+	})
+	return c
+}
+
+// touch records a message read from the client and extends the read
+// deadline.
+func (c *client) touch() {
+	c.lastActiveAt.Store(time.Now().UnixNano())
+	c.ws.SetReadDeadline(time.Now().Add(c.pongWait))
+}
+
+func (c *client) idle() bool {
+	if c.maxIdle <= 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, c.lastActiveAt.Load())) > c.maxIdle
+}
+
+// writePump writes queued events and pings until the client is closed, a
+// write fails or the client has been idle for too long. It must run in its
+// own goroutine; onClose is called with the reason the pump closed the
+// connection.
+func (c *client) writePump(onClose func(err error)) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-c.queue:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.ws.WriteMessage(websocket.TextMessage, event.payload)
+			if err != nil {
+				onClose(err)
+				c.close()
+				return
+			}
+			if event.written != nil {
+				event.written()
+			}
+		case <-ticker.C:
+			if c.idle() {
+				onClose(errIdleTimeout)
+				c.close()
+				return
+			}
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.ws.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				onClose(err)
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close stops the writer and closes the connection, which also ends the
+// read loop of the connection.
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+// enqueue queues the event without blocking. A client whose queue is full is
+// closed as a slow consumer.
+func (c *client) enqueue(event outboundEvent) error {
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+	select {
+	case c.queue <- event:
+		return nil
+	default:
+		c.close()
+		return errSlowConsumer
+	}
+}
+
+// enqueueWait queues the event, waiting for room in the queue. It is used
+// where the caller produces many events in a row, such as replays.
+func (c *client) enqueueWait(event outboundEvent) error {
+	select {
+	case c.queue <- event:
+		return nil
+	case <-c.done:
+		return errClientClosed
+	}
+}
+
+func (c *client) writeJSON(v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(outboundEvent{payload: payload})
+}
+
+func (c *client) writeJSONWait(v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.enqueueWait(outboundEvent{payload: payload})
+}
+
+// hold queues the event if the client is still replaying and reports whether
+// it did so.
+func (c *client) hold(payload []byte, message *receivedMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.replaying {
+		return false
+	}
+	c.pending = append(c.pending, pendingEvent{
+		payload:         payload,
+		receivedMessage: message,
+	})
+	return true
+}
+
+// release ends the replay and writes the held events in order. Messages with
+// a sequence up to lastSequence were already replayed and are skipped. Events
+// held while writing are picked up before the replay is marked as done.
+func (c *client) release(lastSequence int64, write func(event pendingEvent) error) error {
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			c.replaying = false
+			c.mu.Unlock()
+			return nil
+		}
+		c.mu.Unlock()
+
+		for _, event := range pending {
+			if event.receivedMessage != nil && event.receivedMessage.Sequence <= lastSequence {
+				continue
+			}
+			if err := write(event); err != nil {
+				return err
+			}
+		}
+	}
+}
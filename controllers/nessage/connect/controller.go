@@ -1,41 +1,48 @@
 package controllersMessageConnect
 
 import (
+	"data-platform-conversation-kube/config"
 	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	typesMessage "data-platform-conversation-kube/types/message"
 	"fmt"
 	"github.com/astaxie/beego"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
-	database "github.com/latonaio/golang-mysql-network-connector"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 )
 
 type MessageConnectController struct {
 	beego.Controller
 	CustomLogger *logger.Logger
-	DB           *database.Mysql
+	Store        services.ConversationStore
+	Broadcaster  servicesBroadcast.Broadcaster
+	Presence     *servicesPresence.Tracker
+	Hub          *Hub
+	MessageConf  *config.MESSAGE
+	ServerConf   *config.SERVER
+	Events       servicesEvents.Publisher
 }
 
-var (
-	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
-	}
-	rooms = make(map[string]map[string]*websocket.Conn)
-	mu    sync.Mutex
-)
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
 
 type Message struct {
-	Type          string  `json:"type"`
-	Content       *any    `json:"content,omitempty"`
-	MessageID     *string `json:"messageID,omitempty"`
-	MessageSender *int    `json:"messageSender,omitempty"`
-	MessageReader *int    `json:"messageReader,omitempty"`
+	Type        string   `json:"type"`
+	Content     *any     `json:"content,omitempty"`
+	MessageID   *string  `json:"messageID,omitempty"`
+	Scope       *string  `json:"scope,omitempty"`
+	ReplyTo     *string  `json:"replyTo,omitempty"`
+	Emoji       *string  `json:"emoji,omitempty"`
+	Attachments []string `json:"attachments,omitempty"`
 }
 
 const (
@@ -44,6 +51,15 @@ const (
 	ReceivedMessage         = "ReceivedMessage"
 	MarkedMessageToSender   = "MarkedMessageToSender"
 	MarkedMessageFromReader = "MarkedMessageFromReader"
+	Typing                  = "Typing"
+	MessageEdited           = "MessageEdited"
+	MessageDeleted          = "MessageDeleted"
+	ReactionsUpdated        = "ReactionsUpdated"
+	MessageDelivered        = "MessageDelivered"
+	ReadUpToUpdated         = "ReadUpToUpdated"
+	ReplayCompleted         = "ReplayCompleted"
+	MessageAccepted         = "MessageAccepted"
+	DeliveredUpTo           = "DeliveredUpTo"
 )
 
 const (
@@ -56,6 +72,15 @@ const (
 	ConvertMessageReaderToIntToMessageReader          = "ConvertMessageReaderToIntToMessageReader"
 	InsertMessageIntoMessageReadStatus                = "InsertMessageIntoMessageReadStatus"
 	InsertMessageIntoMessageReadStatusToMessageReader = "InsertMessageIntoMessageReadStatusToMessageReader"
+	PublishToRoom                                     = "PublishToRoom"
+	EditMessage                                       = "EditMessage"
+	DeleteMessage                                     = "DeleteMessage"
+	UpdateReaction                                    = "UpdateReaction"
+	InsertMessageDelivery                             = "InsertMessageDelivery"
+	UpdateReadWatermark                               = "UpdateReadWatermark"
+	ReplayMessages                                    = "ReplayMessages"
+	SendAcknowledgement                               = "SendAcknowledgement"
+	PublishEvent                                      = "PublishEvent"
 )
 
 var ErrorMessages = map[string]string{
@@ -68,6 +93,15 @@ var ErrorMessages = map[string]string{
 	ConvertMessageReaderToIntToMessageReader:          "Failed to convert messageReader to int to message reader",
 	InsertMessageIntoMessageReadStatus:                "Failed to insert message into message read status",
 	InsertMessageIntoMessageReadStatusToMessageReader: "Failed to insert message into message read status to message reader",
+	PublishToRoom:                                     "Failed to publish to room",
+	EditMessage:                                       "Failed to edit message",
+	DeleteMessage:                                     "Failed to delete message",
+	UpdateReaction:                                    "Failed to update reaction",
+	InsertMessageDelivery:                             "Failed to insert message delivery",
+	UpdateReadWatermark:                               "Failed to update read watermark",
+	ReplayMessages:                                    "Failed to replay messages",
+	SendAcknowledgement:                               "Failed to send acknowledgement to sender",
+	PublishEvent:                                      "Failed to publish event",
 }
 
 func (controller *MessageConnectController) Connect() {
@@ -83,6 +117,21 @@ func (controller *MessageConnectController) Connect() {
 		return
 	}
 
+	// lastSeq is the sequence of the last message the client has seen; the
+	// messages after it are replayed before live delivery starts.
+	lastSeq := int64(-1)
+	if lastSeqStr := controller.GetString("lastSeq"); lastSeqStr != "" {
+		lastSeq, err = strconv.ParseInt(lastSeqStr, 10, 64)
+		if err != nil || lastSeq < 0 {
+			controller.CustomLogger.Error(
+				"Failed to convert lastSeq to int: ",
+				err,
+				lastSeqStr,
+			)
+			return
+		}
+	}
+
 	ws, err := upgrader.Upgrade(
 		controller.Ctx.ResponseWriter,
 		controller.Ctx.Request,
@@ -92,17 +141,52 @@ func (controller *MessageConnectController) Connect() {
 		controller.CustomLogger.Error("Failed to set websocket upgrade:", err, chatRoom, businessPartner)
 		return
 	}
-	defer ws.Close()
 
-	controller.CustomLogger.Info("Connected room id: %s %s", chatRoom, businessPartner)
+	connectionID := uuid.New().String()
+
+	controller.CustomLogger.Info("Connected room id: %s %d %s", chatRoom, businessPartner, connectionID)
+
+	// The client joins the room before replaying so nothing published in
+	// between is lost; live events are held back until the replay is done.
+	c := newClient(ws, lastSeq >= 0, controller.ServerConf)
+	defer c.close()
+	go c.writePump(func(err error) {
+		controller.CustomLogger.Warn(
+			"Closing connection: %v %s %d %s",
+			err, chatRoom, businessPartner, connectionID,
+		)
+	})
+
+	controller.Hub.add(chatRoom, businessPartner, connectionID, c)
+
+	if lastSeq >= 0 {
+		replayedSeq := controller.replay(c, chatRoom, businessPartner, lastSeq)
+		err := c.release(replayedSeq, func(event pendingEvent) error {
+			return c.enqueueWait(controller.outbound(chatRoom, businessPartner, event.payload, event.receivedMessage))
+		})
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[SendMessageToReceiver],
+				err,
+				chatRoom, businessPartner, connectionID,
+			)
+		}
+	}
 
-	mu.Lock()
-	if rooms[chatRoom] == nil {
-		rooms[chatRoom] = make(map[string]*websocket.Conn)
+	presence := servicesPresence.Connection{
+		ID:              connectionID,
+		ChatRoom:        chatRoom,
+		BusinessPartner: businessPartner,
 	}
-	rooms[chatRoom][strconv.Itoa(businessPartner)] = ws
-	mu.Unlock()
+	if err := controller.Presence.Connect(presence); err != nil {
+		controller.CustomLogger.Error("Failed to track presence: ", err, chatRoom, businessPartner)
+	}
+
+	controller.syncDeliveries(chatRoom, businessPartner)
 
+	typing := &typingState{}
+
+read:
 	for {
 		var msg Message
 		err := ws.ReadJSON(&msg)
@@ -115,6 +199,7 @@ func (controller *MessageConnectController) Connect() {
 			)
 			break
 		}
+		c.touch()
 		switch msg.Type {
 		case "SendMessage":
 			var messageID string
@@ -134,39 +219,100 @@ func (controller *MessageConnectController) Connect() {
 			}
 
 			controller.sendMessage(
-				ws,
-				rooms[chatRoom],
+				c,
 				chatRoom,
 				businessPartner,
 				messageID,
 				messageContent,
+				msg.ReplyTo,
+				msg.Attachments,
 			)
-		case "LeaveRoom":
-			controller.leaveRoom(ws, chatRoom)
-			controller.CustomLogger.Info("Leave room: ", chatRoom, businessPartner)
-		case "MarkMessageAsRead":
-			var messageSender int
-			if msg.MessageSender != nil {
-				messageSender = *msg.MessageSender
+		case "EditMessage":
+			var messageID string
+			if msg.MessageID != nil {
+				messageID = *msg.MessageID
 			} else {
 				controller.CustomLogger.Error(
-					"MessageSender is nil",
+					"MessageID is nil",
 					chatRoom,
 					businessPartner,
 				)
 				continue
 			}
-			var messageReader int
-			if msg.MessageReader != nil {
-				messageReader = *msg.MessageReader
+			var messageContent string
+			if msg.Content != nil {
+				messageContent = fmt.Sprintf("%v", *msg.Content)
+			}
+
+			controller.editMessage(
+				c,
+				chatRoom,
+				businessPartner,
+				messageID,
+				messageContent,
+			)
+		case "DeleteMessage":
+			var messageID string
+			if msg.MessageID != nil {
+				messageID = *msg.MessageID
 			} else {
 				controller.CustomLogger.Error(
-					"MessageReader is nil",
+					"MessageID is nil",
 					chatRoom,
 					businessPartner,
 				)
 				continue
 			}
+			scope := typesMessage.DeleteScopeSelf
+			if msg.Scope != nil {
+				scope = *msg.Scope
+			}
+
+			controller.deleteMessage(
+				c,
+				chatRoom,
+				businessPartner,
+				messageID,
+				scope,
+			)
+		case "AddReaction", "RemoveReaction":
+			var messageID string
+			if msg.MessageID != nil {
+				messageID = *msg.MessageID
+			} else {
+				controller.CustomLogger.Error(
+					"MessageID is nil",
+					chatRoom,
+					businessPartner,
+				)
+				continue
+			}
+			var emoji string
+			if msg.Emoji != nil {
+				emoji = *msg.Emoji
+			} else {
+				controller.CustomLogger.Error(
+					"Emoji is nil",
+					chatRoom,
+					businessPartner,
+				)
+				continue
+			}
+
+			controller.updateReaction(
+				c,
+				chatRoom,
+				businessPartner,
+				messageID,
+				emoji,
+				msg.Type == "AddReaction",
+			)
+		case "LeaveRoom":
+			// Leaving ends this connection only; the room hears about it
+			// once the business partner's last device has gone.
+			controller.CustomLogger.Info("Leave room: ", chatRoom, businessPartner)
+			break read
+		case "MarkMessageAsRead":
 			var messageID string
 			if msg.MessageID != nil {
 				messageID = *msg.MessageID
@@ -180,34 +326,142 @@ func (controller *MessageConnectController) Connect() {
 			}
 
 			controller.markMessageAsRead(
-				ws,
-				rooms[chatRoom],
+				c,
+				chatRoom,
+				businessPartner,
+				messageID,
+			)
+		case "MarkRoomReadUpTo":
+			var messageID string
+			if msg.MessageID != nil {
+				messageID = *msg.MessageID
+			} else {
+				controller.CustomLogger.Error(
+					"MessageID is nil",
+					chatRoom,
+					businessPartner,
+				)
+				continue
+			}
+
+			controller.markRoomReadUpTo(
+				c,
 				chatRoom,
-				messageSender,
-				messageReader,
+				businessPartner,
 				messageID,
 			)
+		case "StartTyping":
+			controller.startTyping(typing, chatRoom, businessPartner)
+		case "StopTyping":
+			controller.stopTyping(typing, chatRoom, businessPartner)
 		}
 	}
 
-	controller.disconnect(rooms[chatRoom], chatRoom, businessPartner)
+	controller.stopTyping(typing, chatRoom, businessPartner)
+	controller.disconnect(chatRoom, businessPartner, connectionID)
+}
+
+// Subscribe registers the delivery of broadcast events to the connections
+// held by this pod. It must be called once before serving connections.
+func (controller *MessageConnectController) Subscribe() error {
+	return controller.Broadcaster.Subscribe(controller.deliver)
+}
+
+func (controller *MessageConnectController) deliver(envelope servicesBroadcast.Envelope) {
+	receivedMessage := parseReceivedMessage(envelope)
+
+	controller.Hub.mu.Lock()
+	defer controller.Hub.mu.Unlock()
+
+	for businessPartner, connections := range controller.Hub.rooms[envelope.ChatRoom] {
+		if !envelope.Recipients.Includes(businessPartner) {
+			continue
+		}
+
+		for connectionID, c := range connections {
+			if c.hold(envelope.Payload, receivedMessage) {
+				continue
+			}
+			// A full queue closes the connection instead of letting a slow
+			// client hold up the room.
+			err := c.enqueue(controller.outbound(envelope.ChatRoom, businessPartner, envelope.Payload, receivedMessage))
+			if err != nil {
+				controller.CustomLogger.Error(
+					ErrorMessages[SendMessageToReceiver],
+					err,
+					envelope.ChatRoom, businessPartner, connectionID,
+				)
+			}
+		}
+	}
+}
+
+// outbound wraps a broadcast payload for a recipient's queue, recording the
+// delivery of messages once they are written.
+func (controller *MessageConnectController) outbound(
+	chatRoom string,
+	businessPartner int,
+	payload []byte,
+	receivedMessage *receivedMessage,
+) outboundEvent {
+	event := outboundEvent{payload: payload}
+	if receivedMessage != nil {
+		event.written = func() {
+			go controller.markDelivered(chatRoom, receivedMessage, businessPartner)
+		}
+	}
+	return event
+}
+
+func (controller *MessageConnectController) publish(
+	c *client,
+	chatRoom string,
+	recipients servicesBroadcast.Recipients,
+	payload map[string]any,
+) {
+	err := controller.Broadcaster.Publish(chatRoom, recipients, payload)
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[PublishToRoom],
+			err,
+			chatRoom, payload["type"],
+		)
+		if c == nil {
+			return
+		}
+		err = c.writeJSON(map[string]any{
+			"type":     Error,
+			"message":  ErrorMessages[PublishToRoom],
+			"chatRoom": chatRoom,
+		})
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[SendErrorResponse],
+				err,
+				chatRoom,
+			)
+		}
+	}
 }
 
 func (controller *MessageConnectController) sendMessage(
-	ws *websocket.Conn,
-	roomConnections map[string]*websocket.Conn,
+	c *client,
 	chatRoom string,
 	businessPartner int,
 	messageID string,
 	content string,
+	replyTo *string,
+	attachmentIDs []string,
 ) {
 	sentAt := time.Now().Format("2006-01-02 15:04:05.999999")
 
-	err := services.InsertConversationHistory(
-		controller.DB,
+	accepted, duplicate, err := controller.Store.InsertConversationHistory(
 		chatRoom, businessPartner,
+		typesMessage.SenderTypeBusinessPartner,
 		messageID, content,
 		sentAt,
+		replyTo,
+		attachmentIDs,
 	)
 	if err != nil {
 		controller.CustomLogger.Error(
@@ -215,9 +469,10 @@ func (controller *MessageConnectController) sendMessage(
 			err,
 			messageID, chatRoom, businessPartner,
 		)
-		err = ws.WriteJSON(map[string]any{
+		err = c.writeJSON(map[string]any{
 			"type":      Error,
 			"message":   ErrorMessages[InsertMessageHistory],
+			"reason":    err.Error(),
 			"messageID": messageID,
 			"chatRoom":  chatRoom,
 			"sender":    businessPartner,
@@ -233,84 +488,254 @@ func (controller *MessageConnectController) sendMessage(
 		return
 	}
 
-	for _, ws := range roomConnections {
-		go func(ws *websocket.Conn) {
-			err = ws.WriteJSON(map[string]any{
-				"type":      ReceivedMessage,
-				"messageID": messageID,
-				"content":   content,
-				"chatRoom":  chatRoom,
-				"sender":    businessPartner,
-				"sentAt":    sentAt,
-			})
-			if err != nil {
-				controller.CustomLogger.Error(
-					ErrorMessages[SendMessageToReceiver],
-					err,
-					messageID, chatRoom, businessPartner,
-				)
-				err = ws.WriteJSON(map[string]any{
-					"type":      Error,
-					"message":   ErrorMessages[SendMessageToReceiver],
-					"messageID": messageID,
-					"chatRoom":  chatRoom,
-					"sender":    businessPartner,
-					"sentAt":    sentAt,
-				})
-				if err != nil {
-					controller.CustomLogger.Error(
-						ErrorMessages[SendErrorResponse],
-						err,
-						messageID, chatRoom, businessPartner,
-					)
-				}
-			}
-		}(ws)
+	// The ack is sent again for a retried MessageID, so a client that lost
+	// its connection after sending can safely send again.
+	err = c.writeJSON(map[string]any{
+		"type":      MessageAccepted,
+		"messageID": accepted.MessageID,
+		"chatRoom":  accepted.ChatRoom,
+		"sentAt":    accepted.SentAt,
+		"sequence":  accepted.Sequence,
+		"duplicate": duplicate,
+	})
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[SendAcknowledgement],
+			err,
+			messageID, chatRoom, businessPartner,
+		)
+	}
+	if duplicate {
+		return
+	}
+
+	var attachments []typesMessage.Attachment
+	if len(attachmentIDs) > 0 {
+		messageAttachments, err := controller.Store.ReadMessageAttachments([]string{messageID})
+		if err != nil {
+			controller.CustomLogger.Error(
+				"Failed to read message attachments: ",
+				err,
+				messageID, chatRoom, businessPartner,
+			)
+		}
+		attachments = messageAttachments[messageID]
 	}
+
+	controller.publish(c, chatRoom, servicesBroadcast.Everyone(), map[string]any{
+		"type":        ReceivedMessage,
+		"messageID":   messageID,
+		"content":     content,
+		"chatRoom":    chatRoom,
+		"sender":      businessPartner,
+		"senderType":  typesMessage.SenderTypeBusinessPartner,
+		"sentAt":      sentAt,
+		"replyTo":     replyTo,
+		"attachments": attachments,
+		"sequence":    accepted.Sequence,
+	})
 }
 
-func (controller *MessageConnectController) leaveRoom(ws *websocket.Conn, chatRoom string) {
-	mu.Lock()
-	defer mu.Unlock()
-	delete(rooms, chatRoom)
-	fmt.Printf("left room %s\n", chatRoom)
-	for room := range rooms {
-		if room == chatRoom {
-			err := ws.WriteJSON(map[string]any{
-				"type":     LeftChat,
-				"message":  fmt.Sprintf("RoomID %s left the chat", chatRoom),
-				"chatRoom": chatRoom,
-				//"businessPartner": businessPartner,
-			})
-			if err != nil {
-				controller.CustomLogger.Error(
-					"Failed to send left chat error message: ",
-					err,
-					chatRoom,
-					//businessPartner,
-				)
-				ws.WriteJSON(map[string]any{
-					"type":    Error,
-					"message": "Failed to send left chat error message",
-				})
-			}
+// publishEvent hands an event without a database change of its own to other
+// services. Failures are logged only; the room has already been told. Events
+// of stored changes go through the outbox instead.
+func (controller *MessageConnectController) publishEvent(
+	eventType string,
+	chatRoom string,
+	payload any,
+) {
+	err := controller.Events.Publish(servicesEvents.NewEvent(eventType, chatRoom, payload))
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[PublishEvent],
+			err,
+			chatRoom, eventType,
+		)
+	}
+}
+
+func (controller *MessageConnectController) editMessage(
+	c *client,
+	chatRoom string,
+	businessPartner int,
+	messageID string,
+	content string,
+) {
+	now := time.Now()
+	editedAt := now.Format("2006-01-02 15:04:05.999999")
+
+	err := controller.Store.EditMessage(
+		chatRoom,
+		messageID,
+		businessPartner,
+		content,
+		now,
+		controller.MessageConf.EditWindow(),
+	)
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[EditMessage],
+			err,
+			messageID, chatRoom, businessPartner,
+		)
+		err = c.writeJSON(map[string]any{
+			"type":      Error,
+			"message":   ErrorMessages[EditMessage],
+			"reason":    err.Error(),
+			"messageID": messageID,
+			"chatRoom":  chatRoom,
+			"sender":    businessPartner,
+		})
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[SendErrorResponse],
+				err,
+				messageID, chatRoom, businessPartner,
+			)
+		}
+		return
+	}
+
+	controller.publish(c, chatRoom, servicesBroadcast.Everyone(), map[string]any{
+		"type":      MessageEdited,
+		"messageID": messageID,
+		"content":   content,
+		"chatRoom":  chatRoom,
+		"sender":    businessPartner,
+		"editedAt":  editedAt,
+	})
+}
+
+func (controller *MessageConnectController) deleteMessage(
+	c *client,
+	chatRoom string,
+	businessPartner int,
+	messageID string,
+	scope string,
+) {
+	deletedAt := time.Now().Format("2006-01-02 15:04:05.999999")
+
+	var err error
+	recipients := servicesBroadcast.Everyone()
+	switch scope {
+	case typesMessage.DeleteScopeEveryone:
+		err = controller.Store.DeleteMessageForEveryone(
+			chatRoom, messageID, businessPartner,
+			deletedAt,
+		)
+	case typesMessage.DeleteScopeSelf:
+		err = controller.Store.DeleteMessageForSelf(
+			chatRoom, messageID, businessPartner,
+			deletedAt,
+		)
+		// Only the other devices of the same business partner hide it.
+		recipients = servicesBroadcast.Only(businessPartner)
+	default:
+		err = services.ErrInvalidScope
+	}
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[DeleteMessage],
+			err,
+			messageID, chatRoom, businessPartner, scope,
+		)
+		err = c.writeJSON(map[string]any{
+			"type":      Error,
+			"message":   ErrorMessages[DeleteMessage],
+			"reason":    err.Error(),
+			"messageID": messageID,
+			"chatRoom":  chatRoom,
+			"scope":     scope,
+		})
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[SendErrorResponse],
+				err,
+				messageID, chatRoom, businessPartner,
+			)
+		}
+		return
+	}
+
+	controller.publish(c, chatRoom, recipients, map[string]any{
+		"type":            MessageDeleted,
+		"messageID":       messageID,
+		"chatRoom":        chatRoom,
+		"businessPartner": businessPartner,
+		"scope":           scope,
+		"deletedAt":       deletedAt,
+	})
+}
+
+func (controller *MessageConnectController) updateReaction(
+	c *client,
+	chatRoom string,
+	businessPartner int,
+	messageID string,
+	emoji string,
+	add bool,
+) {
+	var err error
+	if add {
+		err = controller.Store.AddReaction(
+			chatRoom, messageID, businessPartner, emoji,
+			time.Now().Format("2006-01-02 15:04:05.999999"),
+		)
+	} else {
+		err = controller.Store.RemoveReaction(
+			chatRoom, messageID, businessPartner, emoji,
+		)
+	}
+
+	var reactions map[string][]typesMessage.ReactionCount
+	if err == nil {
+		reactions, err = controller.Store.ReadMessageReactions([]string{messageID})
+	}
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[UpdateReaction],
+			err,
+			messageID, chatRoom, businessPartner, emoji,
+		)
+		err = c.writeJSON(map[string]any{
+			"type":      Error,
+			"message":   ErrorMessages[UpdateReaction],
+			"reason":    err.Error(),
+			"messageID": messageID,
+			"chatRoom":  chatRoom,
+			"emoji":     emoji,
+		})
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[SendErrorResponse],
+				err,
+				messageID, chatRoom, businessPartner,
+			)
 		}
+		return
 	}
+
+	controller.publish(c, chatRoom, servicesBroadcast.Everyone(), map[string]any{
+		"type":      ReactionsUpdated,
+		"messageID": messageID,
+		"chatRoom":  chatRoom,
+		"reactions": reactions[messageID],
+	})
 }
 
+// markMessageAsRead records a read receipt of the connected business partner.
+// The sender is taken from the stored message rather than from the client.
 func (controller *MessageConnectController) markMessageAsRead(
-	ws *websocket.Conn,
-	roomConnections map[string]*websocket.Conn,
+	c *client,
 	roomID string,
-	messageSender int,
 	messageReader int,
 	messageID string,
 ) {
 	readAt := time.Now().Format("2006-01-02 15:04:05.999999")
 	readStatusID := uuid.New().String()
 
-	err := services.InsertMessageReadStatus(
-		controller.DB,
+	messageSender, err := controller.Store.InsertMessageReadStatus(
+		roomID,
 		readStatusID,
 		messageID,
 		messageReader,
@@ -320,15 +745,14 @@ func (controller *MessageConnectController) markMessageAsRead(
 		controller.CustomLogger.Error(
 			ErrorMessages[InsertMessageIntoMessageReadStatus],
 			err,
-			messageID, roomID, messageSender, messageReader,
+			messageID, roomID, messageReader,
 			readStatusID, readAt,
 		)
-		err = ws.WriteJSON(map[string]any{
+		err = c.writeJSON(map[string]any{
 			"type":          Error,
 			"message":       ErrorMessages[InsertMessageIntoMessageReadStatus],
 			"messageID":     messageID,
 			"roomID":        roomID,
-			"messageSender": messageSender,
 			"messageReader": messageReader,
 			"readStatusID":  readStatusID,
 			"readAt":        readAt,
@@ -337,81 +761,114 @@ func (controller *MessageConnectController) markMessageAsRead(
 			controller.CustomLogger.Error(
 				ErrorMessages[SendErrorResponse],
 				err,
-				messageID, roomID, messageSender, messageReader,
+				messageID, roomID, messageReader,
 				readStatusID, readAt,
 			)
 		}
 		return
 	}
 
-	for roomConnectorBusinessPartnerID, ws := range roomConnections {
-		parsedBusinessPartnerID, err := strconv.Atoi(roomConnectorBusinessPartnerID)
+	controller.publish(c, roomID, servicesBroadcast.Only(messageSender), map[string]any{
+		"type":          MarkedMessageToSender,
+		"roomID":        roomID,
+		"messageID":     messageID,
+		"messageReader": messageReader,
+		"readStatusID":  readStatusID,
+		"readAt":        readAt,
+	})
+	controller.publish(c, roomID, servicesBroadcast.Only(messageReader), map[string]any{
+		"type":         MarkedMessageFromReader,
+		"roomID":       roomID,
+		"messageID":    messageID,
+		"readStatusID": readStatusID,
+		"readAt":       readAt,
+	})
+}
 
+func (controller *MessageConnectController) markRoomReadUpTo(
+	c *client,
+	chatRoom string,
+	businessPartner int,
+	messageID string,
+) {
+	readAt := time.Now().Format("2006-01-02 15:04:05.999999")
+
+	watermark, advanced, err := controller.Store.UpdateReadWatermark(
+		chatRoom,
+		businessPartner,
+		messageID,
+		readAt,
+	)
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[UpdateReadWatermark],
+			err,
+			messageID, chatRoom, businessPartner,
+		)
+		err = c.writeJSON(map[string]any{
+			"type":      Error,
+			"message":   ErrorMessages[UpdateReadWatermark],
+			"reason":    err.Error(),
+			"messageID": messageID,
+			"chatRoom":  chatRoom,
+		})
 		if err != nil {
 			controller.CustomLogger.Error(
-				ErrorMessages[ConvertBusinessPartnerIDToInt],
+				ErrorMessages[SendErrorResponse],
 				err,
-				messageID, roomID, messageSender, messageReader,
-				readStatusID, readAt,
+				messageID, chatRoom, businessPartner,
 			)
-			return
-		}
-
-		if parsedBusinessPartnerID == messageSender {
-			go func(ws *websocket.Conn) {
-				err = ws.WriteJSON(map[string]any{
-					"type":         MarkedMessageToSender,
-					"roomID":       roomID,
-					"messageID":    messageID,
-					"readStatusID": readStatusID,
-					"readAt":       readAt,
-				})
-			}(ws)
-		} else if parsedBusinessPartnerID == messageReader {
-			go func(ws *websocket.Conn) {
-				err = ws.WriteJSON(map[string]any{
-					"type":         MarkedMessageFromReader,
-					"roomID":       roomID,
-					"messageID":    messageID,
-					"readStatusID": readStatusID,
-					"readAt":       readAt,
-				})
-			}(ws)
 		}
+		return
 	}
+	// Re-reading older messages leaves the watermark and the room untouched.
+	if !advanced {
+		return
+	}
+
+	controller.publish(c, chatRoom, servicesBroadcast.Everyone(), map[string]any{
+		"type":        ReadUpToUpdated,
+		"chatRoom":    chatRoom,
+		"participant": watermark.Participant,
+		"messageID":   watermark.MessageID,
+		"readAt":      watermark.ReadAt,
+	})
 }
 
 func (controller *MessageConnectController) disconnect(
-	roomConnections map[string]*websocket.Conn,
 	roomID string,
 	businessPartner int,
+	connectionID string,
 ) {
-	mu.Lock()
-	defer mu.Unlock()
-	delete(rooms[roomID], strconv.Itoa(businessPartner))
-	if len(rooms[roomID]) == 0 {
-		delete(rooms, roomID)
+	lastConnection := controller.Hub.remove(roomID, businessPartner, connectionID)
+
+	controller.CustomLogger.Info("Disconnected: %s %d %s", roomID, businessPartner, connectionID)
+
+	presence := servicesPresence.Connection{
+		ID:              connectionID,
+		ChatRoom:        roomID,
+		BusinessPartner: businessPartner,
+	}
+	left, err := controller.Presence.Disconnect(presence)
+	if err != nil {
+		controller.CustomLogger.Error("Failed to track presence: ", err, roomID, businessPartner)
+		// Without the shared count, only this pod's devices are known.
+		left = left || lastConnection
 	}
 
-	for _, ws := range roomConnections {
-		err := ws.WriteJSON(map[string]any{
-			"type":            LeftChat,
-			"message":         fmt.Sprintf("Disconnected user %s", businessPartner),
-			"roomID":          roomID,
-			"businessPartner": businessPartner,
-		})
-		if err != nil {
-			controller.CustomLogger.Error(
-				"Failed to send to disconnected message: ",
-				err,
-				roomID,
-				businessPartner,
-			)
-			ws.WriteJSON(map[string]any{
-				"type":    Error,
-				"message": "Failed to send to disconnected message",
-			})
-		}
+	// Other devices of the same business partner, on this pod or another,
+	// are still in the room.
+	if !left {
+		return
 	}
-	controller.CustomLogger.Info("Disconnected: %s %s", roomID, businessPartner)
+
+	controller.publish(nil, roomID, servicesBroadcast.Everyone(), map[string]any{
+		"type":            LeftChat,
+		"message":         fmt.Sprintf("Disconnected user %d", businessPartner),
+		"roomID":          roomID,
+		"businessPartner": businessPartner,
+	})
+	controller.publishEvent(servicesEvents.ParticipantLeft, roomID, servicesEvents.ParticipantLeftPayload{
+		BusinessPartner: businessPartner,
+	})
 }
@@ -0,0 +1,120 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	"github.com/gorilla/websocket"
+	"testing"
+)
+
+// newTestRoom connects 1001 and 1002 to a direct room on a single pod.
+func newTestRoom(t *testing.T) (sender *websocket.Conn, receiver *websocket.Conn) {
+	t.Helper()
+
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := newTestPod(
+		t,
+		config.NewConf(),
+		store,
+		servicesBroadcast.NewMemoryBroadcaster(),
+		servicesPresence.NewMemoryStore(),
+	)
+	sender = pod.dial(t, *chatRoom, 1001)
+	receiver = pod.dial(t, *chatRoom, 1002)
+	return sender, receiver
+}
+
+func TestSendMessageIsAcceptedOnce(t *testing.T) {
+	sender, receiver := newTestRoom(t)
+
+	send := func(messageID string) map[string]any {
+		sendJSON(t, sender, map[string]any{
+			"type":      "SendMessage",
+			"messageID": messageID,
+			"content":   "hello",
+		})
+		return readUntil(t, sender, MessageAccepted)
+	}
+
+	accepted := send("m1")
+	if accepted["messageID"] != "m1" || accepted["sequence"] != float64(1) {
+		t.Errorf("accepted = %v, want m1 at sequence 1", accepted)
+	}
+	if received := readUntil(t, receiver, ReceivedMessage); received["messageID"] != "m1" || received["sender"] != float64(1001) {
+		t.Errorf("received = %v, want m1 from 1001", received)
+	}
+
+	// A retry is acknowledged with the stored message and not delivered
+	// again: the next message the receiver gets is m2.
+	if retried := send("m1"); retried["sequence"] != accepted["sequence"] || retried["sentAt"] != accepted["sentAt"] {
+		t.Errorf("retry accepted = %v, want %v", retried, accepted)
+	}
+	send("m2")
+	if received := readUntil(t, receiver, ReceivedMessage); received["messageID"] != "m2" {
+		t.Errorf("received = %v, want m2", received)
+	}
+}
+
+func TestMarkMessageAsReadNotifiesSender(t *testing.T) {
+	sender, receiver := newTestRoom(t)
+
+	sendJSON(t, sender, map[string]any{"type": "SendMessage", "messageID": "m1", "content": "hello"})
+	readUntil(t, receiver, ReceivedMessage)
+
+	sendJSON(t, receiver, map[string]any{"type": "MarkMessageAsRead", "messageID": "m1"})
+	marked := readUntil(t, sender, MarkedMessageToSender)
+	if marked["messageID"] != "m1" || marked["messageReader"] != float64(1002) {
+		t.Errorf("marked = %v, want m1 read by 1002", marked)
+	}
+	if fromReader := readUntil(t, receiver, MarkedMessageFromReader); fromReader["messageID"] != "m1" {
+		t.Errorf("reader confirmation = %v, want m1", fromReader)
+	}
+}
+
+func TestDisconnectNotifiesRoom(t *testing.T) {
+	sender, receiver := newTestRoom(t)
+
+	receiver.Close()
+	if left := readUntil(t, sender, LeftChat); left["businessPartner"] != float64(1002) {
+		t.Errorf("left = %v, want 1002", left)
+	}
+}
+
+// Leaving takes only the leaving connection out of the room: everyone else
+// is told and keeps receiving messages.
+func TestLeaveRoomKeepsOtherConnections(t *testing.T) {
+	store := services.NewMemoryStore()
+	chatRoom, err := store.CreateGroupChatRoom(1001, []int{1001, 1002, 1003}, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := newTestPod(
+		t,
+		config.NewConf(),
+		store,
+		servicesBroadcast.NewMemoryBroadcaster(),
+		servicesPresence.NewMemoryStore(),
+	)
+	sender := pod.dial(t, *chatRoom, 1001)
+	receiver := pod.dial(t, *chatRoom, 1002)
+	leaver := pod.dial(t, *chatRoom, 1003)
+
+	sendJSON(t, leaver, map[string]any{"type": "LeaveRoom"})
+	if left := readUntil(t, receiver, LeftChat); left["businessPartner"] != float64(1003) {
+		t.Errorf("left = %v, want 1003", left)
+	}
+	if n := pod.controller.Hub.connections(*chatRoom, 1003); n != 0 {
+		t.Errorf("1003 still has %d connections in the room", n)
+	}
+
+	sendJSON(t, sender, map[string]any{"type": "SendMessage", "messageID": "after-leave", "content": "still here?"})
+	if received := readUntil(t, receiver, ReceivedMessage); received["messageID"] != "after-leave" {
+		t.Errorf("received = %v, want after-leave", received)
+	}
+}
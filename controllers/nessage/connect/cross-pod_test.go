@@ -0,0 +1,300 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/astaxie/beego"
+	"github.com/gorilla/websocket"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPod is one replica of the service: its own hub, broadcaster and
+// presence tracker in front of the store shared by every replica.
+type testPod struct {
+	server     *httptest.Server
+	controller *MessageConnectController
+}
+
+func newTestPod(
+	t *testing.T,
+	conf *config.Conf,
+	store services.ConversationStore,
+	broadcaster servicesBroadcast.Broadcaster,
+	presenceStore servicesPresence.Store,
+) *testPod {
+	t.Helper()
+
+	l := logger.NewLogger()
+	controller := &MessageConnectController{
+		CustomLogger: l,
+		Store:        store,
+		Broadcaster:  broadcaster,
+		Presence:     servicesPresence.NewTracker(presenceStore, store, broadcaster, l),
+		Hub:          NewHub(),
+		MessageConf:  conf.MESSAGE,
+		ServerConf:   conf.SERVER,
+		Events:       servicesEvents.NopPublisher{},
+	}
+	if err := controller.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := beego.NewControllerRegister()
+	handler.Add("/connect/:chatRoom/:businessPartner", controller, "get:Connect")
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &testPod{
+		server:     server,
+		controller: controller,
+	}
+}
+
+// dial connects businessPartner to the room and waits until the pod has
+// registered the connection.
+func (p *testPod) dial(t *testing.T, chatRoom string, businessPartner int) *websocket.Conn {
+	t.Helper()
+
+	before := p.controller.Hub.connections(chatRoom, businessPartner)
+	url := fmt.Sprintf(
+		"ws%s/connect/%s/%d",
+		strings.TrimPrefix(p.server.URL, "http"),
+		chatRoom,
+		businessPartner,
+	)
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	waitFor(t, func() bool {
+		return p.controller.Hub.connections(chatRoom, businessPartner) > before
+	})
+	return ws
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readUntil reads frames until one of the given type arrives.
+func readUntil(t *testing.T, ws *websocket.Conn, eventType string) map[string]any {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, frame, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		var event map[string]any
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event["type"] == eventType {
+			return event
+		}
+	}
+}
+
+func sendJSON(t *testing.T, ws *websocket.Conn, message map[string]any) {
+	t.Helper()
+
+	if err := ws.WriteJSON(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestRedisConf(t *testing.T) *config.Conf {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	host, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDIS_HOST", host)
+	t.Setenv("REDIS_PORT", port)
+	return config.NewConf()
+}
+
+// A message sent to one pod reaches a business partner connected to another
+// pod through Redis alone: once the receiving pod stops listening to Redis,
+// nothing gets through.
+func TestMessageCrossesPodsThroughRedis(t *testing.T) {
+	conf := newTestRedisConf(t)
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPod := func() (*testPod, *servicesBroadcast.RedisBroadcaster) {
+		broadcaster, err := servicesBroadcast.NewRedisBroadcaster(conf.REDIS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { broadcaster.Close() })
+		presenceStore, err := servicesPresence.NewRedisStore(conf.REDIS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newTestPod(t, conf, store, broadcaster, presenceStore), broadcaster
+	}
+	receivingPod, receivingBroadcaster := newPod()
+	sendingPod, _ := newPod()
+
+	receiver := receivingPod.dial(t, *chatRoom, 1002)
+	sender := sendingPod.dial(t, *chatRoom, 1001)
+
+	sendJSON(t, sender, map[string]any{
+		"type":      "SendMessage",
+		"messageID": "cross-pod-1",
+		"content":   "hello from the other pod",
+	})
+
+	received := readUntil(t, receiver, ReceivedMessage)
+	if received["messageID"] != "cross-pod-1" || received["content"] != "hello from the other pod" {
+		t.Errorf("received %v", received)
+	}
+	if received["chatRoom"] != *chatRoom || received["sender"] != float64(1001) {
+		t.Errorf("received %v from the wrong room or sender", received)
+	}
+
+	receivingBroadcaster.Close()
+	sendJSON(t, sender, map[string]any{
+		"type":      "SendMessage",
+		"messageID": "cross-pod-2",
+		"content":   "anyone there?",
+	})
+	readUntil(t, sender, MessageAccepted)
+
+	receiver.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	for {
+		_, frame, err := receiver.ReadMessage()
+		if err != nil {
+			break
+		}
+		if strings.Contains(string(frame), "cross-pod-2") {
+			t.Fatalf("received %s without a Redis subscription", frame)
+		}
+	}
+}
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []servicesEvents.Event
+}
+
+func (r *recordedEvents) Publish(event servicesEvents.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordedEvents) Close() error {
+	return nil
+}
+
+func (r *recordedEvents) count(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, event := range r.events {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+// A business partner leaves the room only when their last device on any pod
+// disconnects, even if it was the last one on its own pod.
+func TestLeftChatCountsDevicesOnEveryPod(t *testing.T) {
+	conf := newTestRedisConf(t)
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	leftChat := 0
+	broadcaster := servicesBroadcast.NewMemoryBroadcaster()
+	err = broadcaster.Subscribe(func(envelope servicesBroadcast.Envelope) {
+		var event map[string]any
+		if err := json.Unmarshal(envelope.Payload, &event); err == nil && event["type"] == LeftChat {
+			mu.Lock()
+			leftChat++
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &recordedEvents{}
+
+	newPod := func() *MessageConnectController {
+		presenceStore, err := servicesPresence.NewRedisStore(conf.REDIS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := logger.NewLogger()
+		return &MessageConnectController{
+			CustomLogger: l,
+			Store:        store,
+			Broadcaster:  broadcaster,
+			Presence:     servicesPresence.NewTracker(presenceStore, store, broadcaster, l),
+			Hub:          NewHub(),
+			Events:       events,
+		}
+	}
+	podA, podB := newPod(), newPod()
+	for pod, connectionID := range map[*MessageConnectController]string{podA: "phone", podB: "laptop"} {
+		err := pod.Presence.Connect(servicesPresence.Connection{
+			ID:              connectionID,
+			ChatRoom:        *chatRoom,
+			BusinessPartner: 1001,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	podA.disconnect(*chatRoom, 1001, "phone")
+	mu.Lock()
+	if leftChat != 0 || events.count(servicesEvents.ParticipantLeft) != 0 {
+		t.Errorf("left the room while the laptop on the other pod is connected: %d LeftChat, %d ParticipantLeft", leftChat, events.count(servicesEvents.ParticipantLeft))
+	}
+	mu.Unlock()
+
+	podB.disconnect(*chatRoom, 1001, "laptop")
+	mu.Lock()
+	defer mu.Unlock()
+	if leftChat != 1 || events.count(servicesEvents.ParticipantLeft) != 1 {
+		t.Errorf("after the last device: %d LeftChat, %d ParticipantLeft, want 1 each", leftChat, events.count(servicesEvents.ParticipantLeft))
+	}
+}
@@ -0,0 +1,112 @@
+package controllersMessageConnect
+
+import (
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"time"
+)
+
+// receivedMessage is the part of a ReceivedMessage payload needed to record
+// its delivery and to skip it after a replay.
+type receivedMessage struct {
+	Type       string `json:"type"`
+	MessageID  string `json:"messageID"`
+	Sender     int    `json:"sender"`
+	SenderType string `json:"senderType"`
+	Sequence   int64  `json:"sequence"`
+}
+
+func parseReceivedMessage(envelope servicesBroadcast.Envelope) *receivedMessage {
+	var message receivedMessage
+	if err := json.Unmarshal(envelope.Payload, &message); err != nil {
+		return nil
+	}
+	if message.Type != ReceivedMessage {
+		return nil
+	}
+	return &message
+}
+
+// markDelivered records the first successful write of a message to any device
+// of the recipient and tells the sender about it.
+func (controller *MessageConnectController) markDelivered(
+	chatRoom string,
+	message *receivedMessage,
+	recipient int,
+) {
+	// Nobody is waiting for receipts of system messages.
+	if message.Sender == recipient || message.SenderType == typesMessage.SenderTypeSystem {
+		return
+	}
+
+	deliveredAt := time.Now().Format("2006-01-02 15:04:05.999999")
+	inserted, err := controller.Store.InsertMessageDelivery(
+		message.MessageID,
+		recipient,
+		deliveredAt,
+	)
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[InsertMessageDelivery],
+			err,
+			message.MessageID, chatRoom, recipient,
+		)
+		return
+	}
+	if !inserted {
+		return
+	}
+
+	controller.publishDelivered(chatRoom, message.MessageID, message.Sender, recipient, deliveredAt)
+}
+
+// syncDeliveries marks every message the business partner missed while
+// offline as delivered once they connect to the room. Each sender gets a
+// single DeliveredUpTo event covering all of their messages up to the
+// sequence, however many there were.
+func (controller *MessageConnectController) syncDeliveries(
+	chatRoom string,
+	businessPartner int,
+) {
+	deliveredAt := time.Now().Format("2006-01-02 15:04:05.999999")
+	delivered, err := controller.Store.MarkChatRoomDelivered(
+		chatRoom,
+		businessPartner,
+		deliveredAt,
+	)
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[InsertMessageDelivery],
+			err,
+			chatRoom, businessPartner,
+		)
+		return
+	}
+
+	for sender, sequence := range delivered {
+		controller.publish(nil, chatRoom, servicesBroadcast.Only(sender), map[string]any{
+			"type":        DeliveredUpTo,
+			"chatRoom":    chatRoom,
+			"recipient":   businessPartner,
+			"sequence":    sequence,
+			"deliveredAt": deliveredAt,
+		})
+	}
+}
+
+func (controller *MessageConnectController) publishDelivered(
+	chatRoom string,
+	messageID string,
+	sender int,
+	recipient int,
+	deliveredAt string,
+) {
+	controller.publish(nil, chatRoom, servicesBroadcast.Only(sender), map[string]any{
+		"type":        MessageDelivered,
+		"chatRoom":    chatRoom,
+		"messageID":   messageID,
+		"recipient":   recipient,
+		"deliveredAt": deliveredAt,
+	})
+}
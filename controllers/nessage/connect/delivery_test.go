@@ -0,0 +1,108 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"fmt"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+type deliveredUpTo struct {
+	Type      string `json:"type"`
+	Recipient int    `json:"recipient"`
+	Sequence  int64  `json:"sequence"`
+}
+
+func TestSyncDeliveriesSendsOneEventPerSender(t *testing.T) {
+	store := services.NewMemoryStore()
+	chatRoom, err := store.CreateGroupChatRoom(1001, []int{1001, 1002, 1003}, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(sender int, senderType string, messageID string) {
+		_, _, err := store.InsertConversationHistory(
+			*chatRoom, sender,
+			senderType,
+			messageID, "hello",
+			time.Now().Format("2006-01-02 15:04:05.999999"),
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		send(1001, typesMessage.SenderTypeBusinessPartner, fmt.Sprintf("from-1001-%d", i))
+	}
+	send(1003, typesMessage.SenderTypeBusinessPartner, "from-1003")
+	send(0, typesMessage.SenderTypeSystem, "from-system")
+	send(1002, typesMessage.SenderTypeBusinessPartner, "from-1002")
+
+	var mu sync.Mutex
+	events := make(map[int][]deliveredUpTo)
+	broadcaster := servicesBroadcast.NewMemoryBroadcaster()
+	err = broadcaster.Subscribe(func(envelope servicesBroadcast.Envelope) {
+		var event deliveredUpTo
+		if err := json.Unmarshal(envelope.Payload, &event); err != nil || event.Type != DeliveredUpTo {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, sender := range envelope.Recipients.BusinessPartners {
+			events[sender] = append(events[sender], event)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller := &MessageConnectController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+		Broadcaster:  broadcaster,
+	}
+
+	controller.syncDeliveries(*chatRoom, 1002)
+
+	mu.Lock()
+	if len(events) != 2 || len(events[1001]) != 1 || len(events[1003]) != 1 {
+		t.Fatalf("events = %+v, want one for 1001 and one for 1003", events)
+	}
+	if got := events[1001][0]; got.Recipient != 1002 || got.Sequence != 3 {
+		t.Errorf("event for 1001 = %+v, want recipient 1002 up to sequence 3", got)
+	}
+	if got := events[1003][0]; got.Recipient != 1002 || got.Sequence != 4 {
+		t.Errorf("event for 1003 = %+v, want recipient 1002 up to sequence 4", got)
+	}
+	events = make(map[int][]deliveredUpTo)
+	mu.Unlock()
+
+	deliveries, err := store.ReadMessageDeliveries([]string{"from-1001-0", "from-1003", "from-system", "from-1002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, messageID := range []string{"from-1001-0", "from-1003"} {
+		if len(deliveries[messageID]) != 1 {
+			t.Errorf("deliveries of %s = %+v, want one to 1002", messageID, deliveries[messageID])
+		}
+	}
+	for _, messageID := range []string{"from-system", "from-1002"} {
+		if len(deliveries[messageID]) != 0 {
+			t.Errorf("deliveries of %s = %+v, want none", messageID, deliveries[messageID])
+		}
+	}
+
+	// Reconnecting without new messages sends nothing.
+	controller.syncDeliveries(*chatRoom, 1002)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 0 {
+		t.Errorf("events after reconnecting = %+v, want none", events)
+	}
+}
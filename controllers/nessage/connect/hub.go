@@ -0,0 +1,53 @@
+package controllersMessageConnect
+
+import (
+	"sync"
+)
+
+// Hub holds the connections of one pod by chat room, business partner and
+// connection ID, so one partner can be connected from several devices.
+// Connections on other pods are reached through the Broadcaster only.
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[string]map[int]map[string]*client
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		rooms: make(map[string]map[int]map[string]*client),
+	}
+}
+
+func (h *Hub) add(chatRoom string, businessPartner int, connectionID string, c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[chatRoom] == nil {
+		h.rooms[chatRoom] = make(map[int]map[string]*client)
+	}
+	if h.rooms[chatRoom][businessPartner] == nil {
+		h.rooms[chatRoom][businessPartner] = make(map[string]*client)
+	}
+	h.rooms[chatRoom][businessPartner][connectionID] = c
+}
+
+// remove returns true when this was the business partner's last connection
+// to the room on this pod.
+func (h *Hub) remove(chatRoom string, businessPartner int, connectionID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.rooms[chatRoom][businessPartner], connectionID)
+	lastConnection := len(h.rooms[chatRoom][businessPartner]) == 0
+	if lastConnection {
+		delete(h.rooms[chatRoom], businessPartner)
+	}
+	if len(h.rooms[chatRoom]) == 0 {
+		delete(h.rooms, chatRoom)
+	}
+	return lastConnection
+}
+
+func (h *Hub) connections(chatRoom string, businessPartner int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.rooms[chatRoom][businessPartner])
+}
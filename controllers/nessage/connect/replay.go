@@ -0,0 +1,121 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/services"
+)
+
+const (
+	replayBatchSize = services.MaxHistoriesLimit
+	// maxReplayMessages bounds the replay on connect. Clients that were away
+	// for longer get a truncated ReplayCompleted and page the histories API.
+	maxReplayMessages = 1000
+)
+
+// replay writes every message of the room with a sequence greater than
+// lastSeq to the client as ReceivedMessage events, followed by
+// ReplayCompleted, and returns the last sequence written.
+func (controller *MessageConnectController) replay(
+	c *client,
+	chatRoom string,
+	businessPartner int,
+	lastSeq int64,
+) int64 {
+	sequence := lastSeq
+	truncated := false
+
+	for replayed := 0; ; {
+		if replayed >= maxReplayMessages {
+			truncated = true
+			break
+		}
+
+		messages, err := controller.Store.ReadMessagesAfterSequence(
+			chatRoom,
+			businessPartner,
+			sequence,
+			replayBatchSize,
+		)
+		if err != nil {
+			controller.CustomLogger.Error(
+				ErrorMessages[ReplayMessages],
+				err,
+				chatRoom, businessPartner, sequence,
+			)
+			err = c.writeJSONWait(map[string]any{
+				"type":     Error,
+				"message":  ErrorMessages[ReplayMessages],
+				"reason":   err.Error(),
+				"chatRoom": chatRoom,
+				"lastSeq":  sequence,
+			})
+			if err != nil {
+				controller.CustomLogger.Error(
+					ErrorMessages[SendErrorResponse],
+					err,
+					chatRoom, businessPartner,
+				)
+			}
+			return sequence
+		}
+
+		messageIDs := make([]string, 0, len(*messages))
+		for _, message := range *messages {
+			messageIDs = append(messageIDs, message.MessageID)
+		}
+		attachments, err := controller.Store.ReadMessageAttachments(messageIDs)
+		if err != nil {
+			controller.CustomLogger.Error(
+				"Failed to read message attachments: ",
+				err,
+				chatRoom, businessPartner,
+			)
+		}
+
+		for _, message := range *messages {
+			err := c.writeJSONWait(map[string]any{
+				"type":        ReceivedMessage,
+				"messageID":   message.MessageID,
+				"content":     message.Content,
+				"chatRoom":    message.ChatRoom,
+				"sender":      message.BusinessPartner,
+				"senderType":  message.SenderType,
+				"sentAt":      message.SentAt,
+				"replyTo":     message.ReplyTo,
+				"attachments": attachments[message.MessageID],
+				"sequence":    message.Sequence,
+				"editedAt":    message.EditedAt,
+				"deletedAt":   message.DeletedAt,
+				"replayed":    true,
+			})
+			if err != nil {
+				controller.CustomLogger.Error(
+					ErrorMessages[ReplayMessages],
+					err,
+					chatRoom, businessPartner, message.Sequence,
+				)
+				return sequence
+			}
+			sequence = message.Sequence
+		}
+
+		replayed += len(*messages)
+		if len(*messages) < replayBatchSize {
+			break
+		}
+	}
+
+	err := c.writeJSONWait(map[string]any{
+		"type":      ReplayCompleted,
+		"chatRoom":  chatRoom,
+		"lastSeq":   sequence,
+		"truncated": truncated,
+	})
+	if err != nil {
+		controller.CustomLogger.Error(
+			ErrorMessages[ReplayMessages],
+			err,
+			chatRoom, businessPartner, sequence,
+		)
+	}
+	return sequence
+}
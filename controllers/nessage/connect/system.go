@@ -0,0 +1,94 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesCommands "data-platform-conversation-kube/services/commands"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"errors"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+// PostSystemMessage handles PostSystemMessage commands from other services.
+// The message is stored with the System sender type and fanned out to the
+// room exactly like one sent over a websocket.
+func (controller *MessageConnectController) PostSystemMessage(body []byte) error {
+	command, err := servicesCommands.ParsePostSystemMessage(body)
+	if err != nil {
+		return err
+	}
+	content, err := command.Render()
+	if err != nil {
+		return err
+	}
+
+	chatRoom := command.ChatRoom
+	if chatRoom == "" {
+		room, _, err := controller.Store.CreateChatRoom(
+			command.BusinessPartners[0],
+			command.BusinessPartners[1],
+		)
+		if err != nil {
+			return err
+		}
+		chatRoom = *room
+	}
+
+	messageID := command.CommandID
+	sentAt := time.Now().Format("2006-01-02 15:04:05.999999")
+
+	accepted, duplicate, err := controller.Store.InsertConversationHistory(
+		chatRoom, 0,
+		typesMessage.SenderTypeSystem,
+		messageID, content,
+		sentAt,
+		nil,
+		nil,
+	)
+	// A command that clashes with a stored message or does not fit the
+	// columns fails the same way on every redelivery.
+	if errors.Is(err, services.ErrChatRoomNotFound) ||
+		errors.Is(err, services.ErrMessageIDConflict) ||
+		services.IsInvalidDataError(err) {
+		return xerrors.Errorf("%v: %w", err, servicesCommands.ErrMalformedCommand)
+	}
+	if err != nil {
+		return err
+	}
+	// A redelivered command was already stored, but its broadcast may have
+	// failed: it is sent again from the stored row, and clients drop a
+	// MessageID they already have.
+	if duplicate {
+		stored, err := controller.Store.ReadMessagesAfterSequence(chatRoom, 0, accepted.Sequence-1, 1)
+		if err != nil {
+			return err
+		}
+		if len(*stored) == 0 || (*stored)[0].MessageID != messageID {
+			return xerrors.Errorf("stored message %s is missing from %s", messageID, chatRoom)
+		}
+		if (*stored)[0].DeletedAt != nil {
+			return nil
+		}
+		content = (*stored)[0].Content
+	}
+
+	// The error requeues the command, so the message reaches the room on
+	// redelivery.
+	err = controller.Broadcaster.Publish(chatRoom, servicesBroadcast.Everyone(), map[string]any{
+		"type":        ReceivedMessage,
+		"messageID":   messageID,
+		"content":     content,
+		"chatRoom":    chatRoom,
+		"sender":      0,
+		"senderType":  typesMessage.SenderTypeSystem,
+		"sentAt":      accepted.SentAt,
+		"replyTo":     nil,
+		"attachments": nil,
+		"sequence":    accepted.Sequence,
+	})
+	if err != nil {
+		return xerrors.Errorf("publish system message error: %w", err)
+	}
+	return nil
+}
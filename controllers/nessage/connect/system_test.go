@@ -0,0 +1,70 @@
+package controllersMessageConnect
+
+import (
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"sync"
+	"testing"
+)
+
+// flakyBroadcaster fails the first publish of a ReceivedMessage, as a Redis
+// outage would.
+type flakyBroadcaster struct {
+	servicesBroadcast.Broadcaster
+	mu     sync.Mutex
+	failed bool
+}
+
+func (b *flakyBroadcaster) Publish(chatRoom string, recipients servicesBroadcast.Recipients, payload any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if message, ok := payload.(map[string]any); ok && message["type"] == ReceivedMessage && !b.failed {
+		b.failed = true
+		return xerrors.New("broadcaster unavailable")
+	}
+	return b.Broadcaster.Publish(chatRoom, recipients, payload)
+}
+
+// A system message whose broadcast failed is stored anyway; the redelivered
+// command must still reach the room.
+func TestPostSystemMessageIsBroadcastOnRedelivery(t *testing.T) {
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := newTestPod(
+		t,
+		config.NewConf(),
+		store,
+		&flakyBroadcaster{Broadcaster: servicesBroadcast.NewMemoryBroadcaster()},
+		servicesPresence.NewMemoryStore(),
+	)
+	receiver := pod.dial(t, *chatRoom, 1002)
+
+	body, err := json.Marshal(map[string]any{
+		"commandID": "c1",
+		"chatRoom":  *chatRoom,
+		"template":  "Delivery {{.delivery}} shipped",
+		"payload":   map[string]any{"delivery": 1234},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pod.controller.PostSystemMessage(body); err == nil {
+		t.Fatal("PostSystemMessage() succeeded although the broadcast failed")
+	}
+	if err := pod.controller.PostSystemMessage(body); err != nil {
+		t.Fatalf("redelivered PostSystemMessage() error = %v", err)
+	}
+
+	received := readUntil(t, receiver, ReceivedMessage)
+	if received["messageID"] != "c1" || received["content"] != "Delivery 1234 shipped" || received["sequence"] != float64(1) {
+		t.Errorf("received = %v, want c1 at sequence 1", received)
+	}
+}
@@ -0,0 +1,95 @@
+package controllersMessageConnect
+
+import (
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	"sync"
+	"time"
+)
+
+const (
+	// typingTimeout emits StopTyping for clients that go quiet without
+	// sending it themselves.
+	typingTimeout = 5 * time.Second
+	// typingThrottle is the minimum interval between two StartTyping, or two
+	// StopTyping, events forwarded to the room from one connection.
+	typingThrottle = time.Second
+)
+
+// typingState is kept per connection; typing indicators never touch MySQL.
+type typingState struct {
+	mu            sync.Mutex
+	typing        bool
+	lastStartedAt time.Time
+	lastStoppedAt time.Time
+	timer         *time.Timer
+}
+
+func (controller *MessageConnectController) startTyping(
+	state *typingState,
+	chatRoom string,
+	businessPartner int,
+) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.timer = time.AfterFunc(typingTimeout, func() {
+		controller.stopTyping(state, chatRoom, businessPartner)
+	})
+
+	// Throttling regardless of the current state keeps clients that
+	// alternate StartTyping and StopTyping from flooding the room.
+	now := time.Now()
+	if now.Sub(state.lastStartedAt) < typingThrottle {
+		return
+	}
+	state.typing = true
+	state.lastStartedAt = now
+
+	controller.publishTyping(chatRoom, businessPartner, true)
+}
+
+func (controller *MessageConnectController) stopTyping(
+	state *typingState,
+	chatRoom string,
+	businessPartner int,
+) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+	if !state.typing {
+		return
+	}
+	// A throttled StopTyping is delayed rather than dropped, so the room
+	// does not keep showing the indicator.
+	now := time.Now()
+	if wait := typingThrottle - now.Sub(state.lastStoppedAt); wait > 0 {
+		state.timer = time.AfterFunc(wait, func() {
+			controller.stopTyping(state, chatRoom, businessPartner)
+		})
+		return
+	}
+	state.typing = false
+	state.lastStoppedAt = now
+
+	controller.publishTyping(chatRoom, businessPartner, false)
+}
+
+func (controller *MessageConnectController) publishTyping(
+	chatRoom string,
+	businessPartner int,
+	typing bool,
+) {
+	controller.publish(nil, chatRoom, servicesBroadcast.Except(businessPartner), map[string]any{
+		"type":            Typing,
+		"chatRoom":        chatRoom,
+		"businessPartner": businessPartner,
+		"typing":          typing,
+	})
+}
@@ -0,0 +1,97 @@
+package controllersMessageConnect
+
+import (
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	"encoding/json"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+// typingRecorder collects the typing flags published to the room.
+type typingRecorder struct {
+	mu     sync.Mutex
+	events []bool
+}
+
+func newTypingController(t *testing.T) (*MessageConnectController, *typingRecorder) {
+	t.Helper()
+
+	recorder := &typingRecorder{}
+	broadcaster := servicesBroadcast.NewMemoryBroadcaster()
+	err := broadcaster.Subscribe(func(envelope servicesBroadcast.Envelope) {
+		var payload struct {
+			Type   string `json:"type"`
+			Typing bool   `json:"typing"`
+		}
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil || payload.Type != Typing {
+			return
+		}
+		recorder.mu.Lock()
+		recorder.events = append(recorder.events, payload.Typing)
+		recorder.mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &MessageConnectController{
+		CustomLogger: logger.NewLogger(),
+		Broadcaster:  broadcaster,
+	}, recorder
+}
+
+func (r *typingRecorder) snapshot() []bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]bool(nil), r.events...)
+}
+
+func TestTypingThrottlesAlternatingStartAndStop(t *testing.T) {
+	controller, recorder := newTypingController(t)
+	state := &typingState{}
+
+	for i := 0; i < 20; i++ {
+		controller.startTyping(state, "room", 1001)
+		controller.stopTyping(state, "room", 1001)
+	}
+
+	got := recorder.snapshot()
+	if len(got) != 2 || got[0] != true || got[1] != false {
+		t.Fatalf("published %v, want one start and one stop", got)
+	}
+}
+
+func TestTypingDelaysThrottledStop(t *testing.T) {
+	controller, recorder := newTypingController(t)
+	state := &typingState{}
+
+	controller.startTyping(state, "room", 1001)
+	controller.stopTyping(state, "room", 1001)
+
+	// The next start is allowed once the throttle has passed, but the stop
+	// that follows comes too soon after the previous one and is delayed.
+	state.mu.Lock()
+	state.lastStartedAt = state.lastStartedAt.Add(-typingThrottle)
+	state.lastStoppedAt = time.Now().Add(-typingThrottle + 50*time.Millisecond)
+	state.mu.Unlock()
+	controller.startTyping(state, "room", 1001)
+	controller.stopTyping(state, "room", 1001)
+
+	if got := recorder.snapshot(); len(got) != 3 {
+		t.Fatalf("published %v before the throttle passed, want start, stop, start", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := recorder.snapshot(); len(got) == 4 {
+			if got[3] != false {
+				t.Fatalf("published %v, want a delayed stop last", got)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("published %v, the delayed stop never arrived", recorder.snapshot())
+}
@@ -0,0 +1,95 @@
+package controllersMessageCreatesGroup
+
+import (
+	"data-platform-conversation-kube/api-input-reader/types"
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"net/http"
+)
+
+type MessageCreatesGroupController struct {
+	beego.Controller
+	UserInfo     *types.Request
+	CustomLogger *logger.Logger
+	Store        services.ConversationStore
+}
+
+func (controller *MessageCreatesGroupController) Post() {
+	badRequest := http.StatusBadRequest
+
+	controller.UserInfo = services.UserRequestParams(
+		services.RequestWrapperController{
+			Controller:   &controller.Controller,
+			CustomLogger: controller.CustomLogger,
+		},
+	)
+
+	var request typesMessage.CreatesGroupRequest
+	err := json.Unmarshal(controller.Ctx.Input.RequestBody, &request)
+	if err != nil {
+		services.HandleError(&controller.Controller, err, &badRequest)
+		return
+	}
+	if request.Title == "" {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("Title is required"),
+			&badRequest,
+		)
+		return
+	}
+
+	roomCreator := *controller.UserInfo.BusinessPartner
+	businessPartners := []int{roomCreator}
+	seen := map[int]bool{roomCreator: true}
+	for _, businessPartner := range request.BusinessPartners {
+		if seen[businessPartner] {
+			continue
+		}
+		seen[businessPartner] = true
+		businessPartners = append(businessPartners, businessPartner)
+	}
+	if len(businessPartners) < 2 {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("BusinessPartners must contain someone other than the creator"),
+			&badRequest,
+		)
+		return
+	}
+
+	chatRoom, err := controller.Store.CreateGroupChatRoom(
+		roomCreator,
+		businessPartners,
+		request.Title,
+	)
+
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("CreateGroupChatRoom error")
+		return
+	}
+
+	businessPartnerDocImages, err := controller.Store.ReadBusinessPartnerDocs(
+		businessPartners,
+	)
+	if err != nil {
+		controller.CustomLogger.Error("ReadBusinessPartnerDocs error: %v", err)
+	}
+
+	controller.Data["json"] = map[string]interface{}{
+		"ChatRoom":                 chatRoom,
+		"Title":                    request.Title,
+		"BusinessPartners":         businessPartners,
+		"BusinessPartnerDocImages": businessPartnerDocImages,
+	}
+	controller.ServeJSON()
+}
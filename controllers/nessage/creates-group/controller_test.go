@@ -0,0 +1,133 @@
+package controllersMessageCreatesGroup
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// relayedEvents publishes the outbox the way the relay does and returns the
+// events it handed over, with their RoomCreated payloads decoded.
+func relayedEvents(t *testing.T, store *services.MemoryStore) []servicesEvents.Event {
+	t.Helper()
+
+	var events []servicesEvents.Event
+	_, err := store.ProcessOutboxEvents(
+		100,
+		func(event servicesEvents.Event) error {
+			var payload servicesEvents.RoomCreatedPayload
+			if err := json.Unmarshal(event.Payload.(json.RawMessage), &payload); err != nil {
+				return err
+			}
+			event.Payload = payload
+			events = append(events, event)
+			return nil
+		},
+		func(int) time.Duration { return time.Second },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+type groupResponse struct {
+	ChatRoom         string
+	Title            string
+	BusinessPartners []int
+}
+
+func newTestHandler(t *testing.T) (*beego.ControllerRegister, *services.MemoryStore) {
+	t.Helper()
+
+	// conf/app.conf turns this on for the service.
+	copyRequestBody := beego.BConfig.CopyRequestBody
+	beego.BConfig.CopyRequestBody = true
+	t.Cleanup(func() { beego.BConfig.CopyRequestBody = copyRequestBody })
+
+	store := services.NewMemoryStore()
+	handler := beego.NewControllerRegister()
+	handler.Add("/creates/group", &MessageCreatesGroupController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+	})
+	return handler, store
+}
+
+func post(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/creates/group?businessPartner=1001", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestPostCreatesGroup(t *testing.T) {
+	handler, store := newTestHandler(t)
+
+	recorder := post(t, handler, `{"Title": "project", "BusinessPartners": [1002, 1001, 1003, 1002]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var response groupResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	// The creator comes first and nobody is listed twice.
+	want := []int{1001, 1002, 1003}
+	if response.Title != "project" || !reflect.DeepEqual(response.BusinessPartners, want) {
+		t.Errorf("response = %+v, want project with %v", response, want)
+	}
+	members, err := store.ReadChatRoomsMembers([]string{response.ChatRoom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members[response.ChatRoom], want) {
+		t.Errorf("members = %v, want %v", members[response.ChatRoom], want)
+	}
+
+	events := relayedEvents(t, store)
+	if len(events) != 1 || events[0].ChatRoom != response.ChatRoom {
+		t.Fatalf("relayed %+v, want one RoomCreated for %s", events, response.ChatRoom)
+	}
+	payload := events[0].Payload.(servicesEvents.RoomCreatedPayload)
+	if payload.RoomType != typesMessage.RoomTypeGroup || payload.RoomCreator != 1001 ||
+		payload.Title == nil || *payload.Title != "project" || !reflect.DeepEqual(payload.Participants, want) {
+		t.Errorf("event payload = %+v, want project created by 1001 with %v", payload, want)
+	}
+}
+
+func TestPostRejectsInvalidGroups(t *testing.T) {
+	handler, store := newTestHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "malformed JSON", body: `{"Title": `},
+		{name: "no title", body: `{"BusinessPartners": [1002]}`},
+		{name: "only the creator", body: `{"Title": "alone", "BusinessPartners": [1001]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if recorder := post(t, handler, tt.body); recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+		})
+	}
+	if events := relayedEvents(t, store); len(events) != 0 {
+		t.Errorf("relayed %d events for rejected groups", len(events))
+	}
+}
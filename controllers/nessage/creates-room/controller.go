@@ -5,14 +5,13 @@ import (
 	"data-platform-conversation-kube/services"
 	"github.com/astaxie/beego"
 	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
-	database "github.com/latonaio/golang-mysql-network-connector"
 )
 
 type MessageCreatesRoomController struct {
 	beego.Controller
 	UserInfo     *types.Request
 	CustomLogger *logger.Logger
-	DB           *database.Mysql
+	Store        services.ConversationStore
 }
 
 func (controller *MessageCreatesRoomController) Get() {
@@ -25,8 +24,7 @@ func (controller *MessageCreatesRoomController) Get() {
 		},
 	)
 
-	chatRoom, err := services.CreateChatRoom(
-		controller.DB,
+	chatRoom, _, err := controller.Store.CreateChatRoom(
 		*controller.UserInfo.BusinessPartner,
 		roomPartner,
 	)
@@ -46,8 +44,7 @@ func (controller *MessageCreatesRoomController) Get() {
 		roomPartner,
 	}
 
-	businessPartnerDocImages, err := services.ReadBusinessPartnerDocs(
-		controller.DB,
+	businessPartnerDocImages, err := controller.Store.ReadBusinessPartnerDocs(
 		businessPartners,
 	)
 
@@ -0,0 +1,96 @@
+package controllersMessageCreatesRoom
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// relayedEvents publishes the outbox the way the relay does and returns the
+// events it handed over, with their RoomCreated payloads decoded.
+func relayedEvents(t *testing.T, store *services.MemoryStore) []servicesEvents.Event {
+	t.Helper()
+
+	var events []servicesEvents.Event
+	_, err := store.ProcessOutboxEvents(
+		100,
+		func(event servicesEvents.Event) error {
+			var payload servicesEvents.RoomCreatedPayload
+			if err := json.Unmarshal(event.Payload.(json.RawMessage), &payload); err != nil {
+				return err
+			}
+			event.Payload = payload
+			events = append(events, event)
+			return nil
+		},
+		func(int) time.Duration { return time.Second },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestGetCreatesOneRoomPerPair(t *testing.T) {
+	store := services.NewMemoryStore()
+	store.PutBusinessPartnerDoc(services.BusinessPartnerDoc{BusinessPartner: 1002, DocType: "IMAGE"})
+	handler := beego.NewControllerRegister()
+	handler.Add("/creates/room", &MessageCreatesRoomController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+	})
+
+	create := func(creator string, partner string) (string, []services.BusinessPartnerDoc) {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/creates/room?businessPartner="+creator+"&roomPartner="+partner, nil)
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+		}
+		var response struct {
+			ChatRoom                 string
+			BusinessPartnerDocImages []services.BusinessPartnerDoc
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.ChatRoom, response.BusinessPartnerDocImages
+	}
+
+	chatRoom, docs := create("1001", "1002")
+	if isMember, _ := store.IsChatRoomMember(chatRoom, 1002); !isMember {
+		t.Errorf("1002 is not a member of the created room %s", chatRoom)
+	}
+	if len(docs) != 1 || docs[0].BusinessPartner != 1002 {
+		t.Errorf("BusinessPartnerDocImages = %+v, want the image of 1002", docs)
+	}
+
+	// Either partner gets the existing room back without a second event.
+	if again, _ := create("1002", "1001"); again != chatRoom {
+		t.Errorf("second create returned %s, want %s", again, chatRoom)
+	}
+
+	events := relayedEvents(t, store)
+	if len(events) != 1 {
+		t.Fatalf("relayed %d events, want one RoomCreated", len(events))
+	}
+	event := events[0]
+	want := servicesEvents.RoomCreatedPayload{
+		RoomType:     typesMessage.RoomTypeDirect,
+		RoomCreator:  1001,
+		Participants: []int{1001, 1002},
+	}
+	if event.Type != servicesEvents.RoomCreated || event.ChatRoom != chatRoom || !reflect.DeepEqual(event.Payload, want) {
+		t.Errorf("event = %+v, want RoomCreated %+v for %s", event, want, chatRoom)
+	}
+}
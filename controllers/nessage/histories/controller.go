@@ -3,20 +3,23 @@ package controllersMessageHistories
 import (
 	"data-platform-conversation-kube/api-input-reader/types"
 	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
 	"github.com/astaxie/beego"
 	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
-	database "github.com/latonaio/golang-mysql-network-connector"
+	"golang.org/x/xerrors"
+	"net/http"
 )
 
 type MessageHistoriesController struct {
 	beego.Controller
 	UserInfo     *types.Request
 	CustomLogger *logger.Logger
-	DB           *database.Mysql
+	Store        services.ConversationStore
 }
 
 func (controller *MessageHistoriesController) Get() {
 	chatRoom := controller.GetString(":chatRoom")
+	badRequest := http.StatusBadRequest
 
 	controller.UserInfo = services.UserRequestParams(
 		services.RequestWrapperController{
@@ -25,9 +28,44 @@ func (controller *MessageHistoriesController) Get() {
 		},
 	)
 
-	conversationHistories, err := services.ReadConversationHistoryWithReadStatus(
-		controller.DB,
+	before, err := services.DecodeHistoryCursor(controller.GetString("before"))
+	if err != nil {
+		services.HandleError(&controller.Controller, err, &badRequest)
+		return
+	}
+	after, err := services.DecodeHistoryCursor(controller.GetString("after"))
+	if err != nil {
+		services.HandleError(&controller.Controller, err, &badRequest)
+		return
+	}
+	if before != nil && after != nil {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("before and after cannot be combined"),
+			&badRequest,
+		)
+		return
+	}
+
+	limit, err := controller.GetInt("limit", services.DefaultHistoriesLimit)
+	if err != nil || limit <= 0 {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("limit must be a positive number"),
+			&badRequest,
+		)
+		return
+	}
+	if limit > services.MaxHistoriesLimit {
+		limit = services.MaxHistoriesLimit
+	}
+
+	conversationHistories, nextCursor, err := controller.Store.ReadConversationHistoryWithReadStatus(
 		chatRoom,
+		*controller.UserInfo.BusinessPartner,
+		before,
+		after,
+		limit,
 	)
 
 	if err != nil {
@@ -36,12 +74,154 @@ func (controller *MessageHistoriesController) Get() {
 			err,
 			nil,
 		)
-		controller.CustomLogger.Error("CreateChatRoom error")
+		controller.CustomLogger.Error("ReadConversationHistoryWithReadStatus error")
+		return
+	}
+
+	err = controller.readReactions(*conversationHistories)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadMessageReactions error")
+		return
+	}
+
+	err = controller.readAttachments(*conversationHistories)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadMessageAttachments error")
+		return
+	}
+
+	err = controller.readDeliveries(*conversationHistories)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadMessageDeliveries error")
+		return
+	}
+
+	withRevisions, _ := controller.GetBool("revisions", false)
+	if withRevisions {
+		err = controller.readRevisions(*conversationHistories)
+		if err != nil {
+			services.HandleError(
+				&controller.Controller,
+				err,
+				nil,
+			)
+			controller.CustomLogger.Error("ReadMessageRevisions error")
+			return
+		}
+	}
+
+	readWatermarks, err := controller.Store.ReadReadWatermarks(chatRoom)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadReadWatermarks error")
 		return
 	}
 
 	controller.Data["json"] = map[string]interface{}{
 		"ConversationHistories": conversationHistories,
+		"NextCursor":            services.EncodeHistoryCursor(nextCursor),
+		"ReadWatermarks":        readWatermarks,
 	}
 	controller.ServeJSON()
 }
+
+func (controller *MessageHistoriesController) readRevisions(
+	conversationHistories []typesMessage.ConversationHistoryWithReadStatus,
+) error {
+	var messageIDs []string
+	for _, history := range conversationHistories {
+		if history.EditedAt != nil && history.DeletedAt == nil {
+			messageIDs = append(messageIDs, history.MessageID)
+		}
+	}
+
+	revisions, err := controller.Store.ReadMessageRevisions(messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, history := range conversationHistories {
+		conversationHistories[i].Revisions = revisions[history.MessageID]
+	}
+	return nil
+}
+
+func (controller *MessageHistoriesController) readReactions(
+	conversationHistories []typesMessage.ConversationHistoryWithReadStatus,
+) error {
+	var messageIDs []string
+	for _, history := range conversationHistories {
+		if history.DeletedAt == nil {
+			messageIDs = append(messageIDs, history.MessageID)
+		}
+	}
+
+	reactions, err := controller.Store.ReadMessageReactions(messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, history := range conversationHistories {
+		conversationHistories[i].Reactions = reactions[history.MessageID]
+	}
+	return nil
+}
+
+func (controller *MessageHistoriesController) readAttachments(
+	conversationHistories []typesMessage.ConversationHistoryWithReadStatus,
+) error {
+	var messageIDs []string
+	for _, history := range conversationHistories {
+		if history.DeletedAt == nil {
+			messageIDs = append(messageIDs, history.MessageID)
+		}
+	}
+
+	attachments, err := controller.Store.ReadMessageAttachments(messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, history := range conversationHistories {
+		conversationHistories[i].Attachments = attachments[history.MessageID]
+	}
+	return nil
+}
+
+func (controller *MessageHistoriesController) readDeliveries(
+	conversationHistories []typesMessage.ConversationHistoryWithReadStatus,
+) error {
+	var messageIDs []string
+	for _, history := range conversationHistories {
+		messageIDs = append(messageIDs, history.MessageID)
+	}
+
+	deliveries, err := controller.Store.ReadMessageDeliveries(messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i, history := range conversationHistories {
+		conversationHistories[i].Deliveries = deliveries[history.MessageID]
+	}
+	return nil
+}
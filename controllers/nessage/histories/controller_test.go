@@ -0,0 +1,146 @@
+package controllersMessageHistories
+
+import (
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type historiesResponse struct {
+	ConversationHistories []typesMessage.ConversationHistoryWithReadStatus
+	NextCursor            *string
+	ReadWatermarks        []typesMessage.ReadWatermark
+}
+
+// newTestHandler serves histories of a direct room between 1001 and 1002
+// holding three messages sent a second apart.
+func newTestHandler(t *testing.T) (*beego.ControllerRegister, *services.MemoryStore, string) {
+	t.Helper()
+
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentAt := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		_, _, err := store.InsertConversationHistory(
+			*chatRoom,
+			1001,
+			typesMessage.SenderTypeBusinessPartner,
+			fmt.Sprintf("m%d", i),
+			fmt.Sprintf("message %d", i),
+			sentAt.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05.999999"),
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := beego.NewControllerRegister()
+	handler.Add("/histories/:chatRoom", &MessageHistoriesController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+	})
+	return handler, store, *chatRoom
+}
+
+func get(t *testing.T, handler http.Handler, chatRoom string, query url.Values) (int, historiesResponse) {
+	t.Helper()
+
+	query.Set("businessPartner", "1002")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/histories/"+chatRoom+"?"+query.Encode(), nil))
+
+	var response historiesResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func messageIDs(histories []typesMessage.ConversationHistoryWithReadStatus) []string {
+	ids := make([]string, len(histories))
+	for i, history := range histories {
+		ids[i] = history.MessageID
+	}
+	return ids
+}
+
+func TestGetPagesBackwards(t *testing.T) {
+	handler, _, chatRoom := newTestHandler(t)
+
+	status, page := get(t, handler, chatRoom, url.Values{"limit": {"2"}})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if got := messageIDs(page.ConversationHistories); fmt.Sprint(got) != "[m2 m3]" {
+		t.Errorf("first page = %v, want [m2 m3]", got)
+	}
+	if page.NextCursor == nil {
+		t.Fatal("first page has no NextCursor")
+	}
+
+	status, page = get(t, handler, chatRoom, url.Values{"limit": {"2"}, "before": {*page.NextCursor}})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if got := messageIDs(page.ConversationHistories); fmt.Sprint(got) != "[m1]" {
+		t.Errorf("second page = %v, want [m1]", got)
+	}
+	if page.NextCursor != nil {
+		t.Errorf("last page NextCursor = %q, want none", *page.NextCursor)
+	}
+}
+
+func TestGetIncludesReadWatermarks(t *testing.T) {
+	handler, store, chatRoom := newTestHandler(t)
+	if _, _, err := store.UpdateReadWatermark(chatRoom, 1002, "m2", "2024-04-01 09:00:10"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, page := get(t, handler, chatRoom, url.Values{})
+	if len(page.ReadWatermarks) != 1 || page.ReadWatermarks[0].Participant != 1002 || page.ReadWatermarks[0].MessageID != "m2" {
+		t.Errorf("ReadWatermarks = %+v, want 1002 up to m2", page.ReadWatermarks)
+	}
+	for _, history := range page.ConversationHistories {
+		read := len(history.ReadParticipants) == 1 && history.ReadParticipants[0] == 1002
+		if want := history.MessageID != "m3"; read != want {
+			t.Errorf("%s ReadParticipants = %v, read by 1002 = %v", history.MessageID, history.ReadParticipants, want)
+		}
+	}
+}
+
+func TestGetRejectsInvalidParameters(t *testing.T) {
+	handler, _, chatRoom := newTestHandler(t)
+	cursor := *services.EncodeHistoryCursor(&typesMessage.HistoryCursor{SentAt: "2024-04-01 09:00:02", MessageID: "m2"})
+
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{name: "zero limit", query: url.Values{"limit": {"0"}}},
+		{name: "limit not a number", query: url.Values{"limit": {"ten"}}},
+		{name: "malformed cursor", query: url.Values{"before": {"not a cursor"}}},
+		{name: "before and after", query: url.Values{"before": {cursor}, "after": {cursor}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := get(t, handler, chatRoom, tt.query); status != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controllersMessagePresence
+
+import (
+	"data-platform-conversation-kube/api-input-reader/types"
+	"data-platform-conversation-kube/services"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type MessagePresenceController struct {
+	beego.Controller
+	UserInfo     *types.Request
+	CustomLogger *logger.Logger
+	Presence     *servicesPresence.Tracker
+}
+
+func (controller *MessagePresenceController) Get() {
+	badRequest := http.StatusBadRequest
+
+	controller.UserInfo = services.UserRequestParams(
+		services.RequestWrapperController{
+			Controller:   &controller.Controller,
+			CustomLogger: controller.CustomLogger,
+		},
+	)
+
+	var businessPartners []int
+	for _, v := range strings.Split(controller.GetString("businessPartners"), ",") {
+		if v == "" {
+			continue
+		}
+		businessPartner, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			services.HandleError(
+				&controller.Controller,
+				xerrors.Errorf("invalid business partner %s", v),
+				&badRequest,
+			)
+			return
+		}
+		businessPartners = append(businessPartners, businessPartner)
+	}
+	if len(businessPartners) == 0 || len(businessPartners) > services.MaxPresenceBusinessPartners {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.Errorf("businessPartners must list 1 to %d business partners", services.MaxPresenceBusinessPartners),
+			&badRequest,
+		)
+		return
+	}
+
+	presences, err := controller.Presence.Read(businessPartners)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadPresence error")
+		return
+	}
+
+	controller.Data["json"] = map[string]interface{}{
+		"Presences": presences,
+	}
+	controller.ServeJSON()
+}
@@ -0,0 +1,104 @@
+package controllersMessagePresence
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestHandler(t *testing.T) (*beego.ControllerRegister, *servicesPresence.Tracker) {
+	t.Helper()
+
+	l := logger.NewLogger()
+	store := services.NewMemoryStore()
+	tracker := servicesPresence.NewTracker(
+		servicesPresence.NewMemoryStore(),
+		store,
+		servicesBroadcast.NewMemoryBroadcaster(),
+		l,
+	)
+	handler := beego.NewControllerRegister()
+	handler.Add("/presence", &MessagePresenceController{
+		CustomLogger: l,
+		Presence:     tracker,
+	})
+	return handler, tracker
+}
+
+func get(t *testing.T, handler http.Handler, businessPartners string) (int, []typesMessage.Presence) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/presence?businessPartner=1001&businessPartners="+url.QueryEscape(businessPartners), nil)
+	handler.ServeHTTP(recorder, request)
+
+	var response struct {
+		Presences []typesMessage.Presence
+	}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response.Presences
+}
+
+func TestGetReportsPresence(t *testing.T) {
+	handler, tracker := newTestHandler(t)
+
+	online := servicesPresence.Connection{ID: "phone", ChatRoom: "room-1", BusinessPartner: 1002}
+	left := servicesPresence.Connection{ID: "laptop", ChatRoom: "room-1", BusinessPartner: 1003}
+	for _, connection := range []servicesPresence.Connection{online, left} {
+		if err := tracker.Connect(connection); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tracker.Disconnect(left); err != nil {
+		t.Fatal(err)
+	}
+
+	status, presences := get(t, handler, "1002, 1003,1004")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(presences) != 3 {
+		t.Fatalf("presences = %+v, want three", presences)
+	}
+	if p := presences[0]; p.BusinessPartner != 1002 || p.Status != typesMessage.PresenceOnline {
+		t.Errorf("1002 = %+v, want online", p)
+	}
+	if p := presences[1]; p.BusinessPartner != 1003 || p.Status != typesMessage.PresenceOffline || p.LastSeenAt == nil {
+		t.Errorf("1003 = %+v, want offline with a last seen time", p)
+	}
+	if p := presences[2]; p.BusinessPartner != 1004 || p.Status != typesMessage.PresenceOffline || p.LastSeenAt != nil {
+		t.Errorf("1004 = %+v, want offline and never seen", p)
+	}
+}
+
+func TestGetRejectsInvalidBusinessPartners(t *testing.T) {
+	handler, _ := newTestHandler(t)
+
+	tooMany := make([]string, services.MaxPresenceBusinessPartners+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(2000 + i)
+	}
+	for name, businessPartners := range map[string]string{
+		"none":         "",
+		"not a number": "1002,abc",
+		"too many":     strings.Join(tooMany, ","),
+	} {
+		if status, _ := get(t, handler, businessPartners); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", name, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package controllersMessageRooms
+
+import (
+	"data-platform-conversation-kube/api-input-reader/types"
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"net/http"
+)
+
+const (
+	DefaultRoomsLimit = 20
+	MaxRoomsLimit     = 100
+)
+
+type MessageRoomsController struct {
+	beego.Controller
+	UserInfo     *types.Request
+	CustomLogger *logger.Logger
+	Store        services.ConversationStore
+}
+
+func (controller *MessageRoomsController) Get() {
+	businessPartner, _ := controller.GetInt(":businessPartner")
+	badRequest := http.StatusBadRequest
+
+	controller.UserInfo = services.UserRequestParams(
+		services.RequestWrapperController{
+			Controller:   &controller.Controller,
+			CustomLogger: controller.CustomLogger,
+		},
+	)
+
+	limit, err := controller.GetInt("limit", DefaultRoomsLimit)
+	if err != nil || limit <= 0 {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("limit must be a positive number"),
+			&badRequest,
+		)
+		return
+	}
+	if limit > MaxRoomsLimit {
+		limit = MaxRoomsLimit
+	}
+	offset, err := controller.GetInt("offset", 0)
+	if err != nil || offset < 0 {
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("offset must be zero or a positive number"),
+			&badRequest,
+		)
+		return
+	}
+
+	var ascending bool
+	switch controller.GetString("order", "desc") {
+	case "asc":
+		ascending = true
+	case "desc":
+	default:
+		services.HandleError(
+			&controller.Controller,
+			xerrors.New("order must be asc or desc"),
+			&badRequest,
+		)
+		return
+	}
+
+	chatRooms, err := controller.Store.ReadChatRooms(
+		businessPartner,
+		ascending,
+		limit+1,
+		offset,
+	)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadChatRooms error")
+		return
+	}
+
+	var nextOffset *int
+	if len(*chatRooms) > limit {
+		*chatRooms = (*chatRooms)[:limit]
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	err = controller.readCounterparts(businessPartner, *chatRooms)
+	if err != nil {
+		services.HandleError(
+			&controller.Controller,
+			err,
+			nil,
+		)
+		controller.CustomLogger.Error("ReadCounterparts error")
+		return
+	}
+
+	controller.Data["json"] = map[string]interface{}{
+		"ChatRooms":  chatRooms,
+		"NextOffset": nextOffset,
+	}
+	controller.ServeJSON()
+}
+
+func (controller *MessageRoomsController) readCounterparts(
+	businessPartner int,
+	chatRooms []typesMessage.ChatRoomSummary,
+) error {
+	chatRoomIDs := make([]string, len(chatRooms))
+	for i, chatRoom := range chatRooms {
+		chatRoomIDs[i] = chatRoom.ChatRoom
+	}
+
+	members, err := controller.Store.ReadChatRoomsMembers(chatRoomIDs)
+	if err != nil {
+		return err
+	}
+
+	profiles := make(map[int][]typesMessage.BusinessPartnerWithDetails)
+	for i, chatRoom := range chatRooms {
+		chatRooms[i].Counterparts = []typesMessage.BusinessPartnerWithDetails{}
+		for _, member := range members[chatRoom.ChatRoom] {
+			if member == businessPartner {
+				continue
+			}
+			if _, ok := profiles[member]; !ok {
+				profile, err := controller.Store.ReadBusinessPartnerWithDetails(member)
+				if err != nil {
+					return err
+				}
+				profiles[member] = *profile
+			}
+			chatRooms[i].Counterparts = append(chatRooms[i].Counterparts, profiles[member]...)
+		}
+	}
+	return nil
+}
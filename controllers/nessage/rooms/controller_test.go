@@ -0,0 +1,123 @@
+package controllersMessageRooms
+
+import (
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/astaxie/beego"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type roomsResponse struct {
+	ChatRooms  []typesMessage.ChatRoomSummary
+	NextOffset *int
+}
+
+// newTestHandler serves the rooms of 1001: a direct room with 1002 holding
+// an unread message and an older group with 1003.
+func newTestHandler(t *testing.T) (*beego.ControllerRegister, string, string) {
+	t.Helper()
+
+	store := services.NewMemoryStore()
+	direct, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := store.CreateGroupChatRoom(1003, []int{1001, 1003}, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = store.InsertConversationHistory(
+		*direct,
+		1002,
+		typesMessage.SenderTypeBusinessPartner,
+		"m1",
+		"hello",
+		time.Now().Add(time.Minute).Format("2006-01-02 15:04:05.999999"),
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, businessPartner := range []int{1001, 1002, 1003} {
+		store.PutBusinessPartner(typesMessage.BusinessPartnerWithDetails{
+			BusinessPartner: businessPartner,
+			NickName:        "partner",
+		})
+	}
+
+	handler := beego.NewControllerRegister()
+	handler.Add("/rooms/:businessPartner", &MessageRoomsController{
+		CustomLogger: logger.NewLogger(),
+		Store:        store,
+	})
+	return handler, *direct, *group
+}
+
+func get(t *testing.T, handler http.Handler, query string) (int, roomsResponse) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rooms/1001?"+query, nil))
+
+	var response roomsResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func TestGetListsRoomsByLastActivity(t *testing.T) {
+	handler, direct, group := newTestHandler(t)
+
+	status, page := get(t, handler, "limit=1")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if len(page.ChatRooms) != 1 || page.ChatRooms[0].ChatRoom != direct {
+		t.Fatalf("first page = %+v, want the direct room", page.ChatRooms)
+	}
+	room := page.ChatRooms[0]
+	if room.UnreadCount != 1 || room.LastMessage == nil || room.LastMessage.MessageID != "m1" {
+		t.Errorf("direct room = %+v, want one unread message m1", room)
+	}
+	if len(room.Counterparts) != 1 || room.Counterparts[0].BusinessPartner != 1002 {
+		t.Errorf("direct room counterparts = %+v, want 1002", room.Counterparts)
+	}
+	if page.NextOffset == nil || *page.NextOffset != 1 {
+		t.Fatalf("NextOffset = %v, want 1", page.NextOffset)
+	}
+
+	_, page = get(t, handler, "limit=1&offset=1")
+	if len(page.ChatRooms) != 1 || page.ChatRooms[0].ChatRoom != group {
+		t.Fatalf("second page = %+v, want the group", page.ChatRooms)
+	}
+	if counterparts := page.ChatRooms[0].Counterparts; len(counterparts) != 1 || counterparts[0].BusinessPartner != 1003 {
+		t.Errorf("group counterparts = %+v, want 1003", counterparts)
+	}
+	if page.NextOffset != nil {
+		t.Errorf("last page NextOffset = %d, want none", *page.NextOffset)
+	}
+
+	_, page = get(t, handler, "order=asc")
+	if len(page.ChatRooms) != 2 || page.ChatRooms[0].ChatRoom != group {
+		t.Errorf("ascending = %+v, want the group first", page.ChatRooms)
+	}
+}
+
+func TestGetRejectsInvalidParameters(t *testing.T) {
+	handler, _, _ := newTestHandler(t)
+
+	for _, query := range []string{"limit=0", "offset=-1", "order=random"} {
+		if status, _ := get(t, handler, query); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -5,14 +5,13 @@ import (
 	"data-platform-conversation-kube/services"
 	"github.com/astaxie/beego"
 	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
-	database "github.com/latonaio/golang-mysql-network-connector"
 )
 
 type MessageUserProfileController struct {
 	beego.Controller
 	UserInfo     *types.Request
 	CustomLogger *logger.Logger
-	DB           *database.Mysql
+	Store        services.ConversationStore
 }
 
 func (controller *MessageUserProfileController) Get() {
@@ -25,8 +24,7 @@ func (controller *MessageUserProfileController) Get() {
 		},
 	)
 
-	userProfile, err := services.ReadBusinessPartnerWithDetails(
-		controller.DB,
+	userProfile, err := controller.Store.ReadBusinessPartnerWithDetails(
 		businessPartner,
 	)
 
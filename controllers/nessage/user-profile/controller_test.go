@@ -0,0 +1,132 @@
+package controllersMessageUserProfile
+
+import (
+	"data-platform-conversation-kube/config"
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testHS256Secret = "test-secret"
+
+type userProfileResponse struct {
+	UserProfile []typesMessage.BusinessPartnerWithDetails
+}
+
+// newTestHandler serves profiles behind the filters the router installs.
+// 1001 shares a direct room with 1002; 1003 has a profile but no room with
+// either, and 1004 shares a room with 1001 but has no profile.
+func newTestHandler(t *testing.T) *beego.ControllerRegister {
+	t.Helper()
+
+	t.Setenv("JWT_HS256_SECRET", testHS256Secret)
+	t.Setenv("JWT_RS256_PUBLIC_KEY", "")
+	t.Setenv("JWT_RS256_PUBLIC_KEY_PATH", "")
+	t.Setenv("JWT_BUSINESS_PARTNER_CLAIM", "")
+	verifier, err := services.NewTokenVerifier(config.NewConf().AUTH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := services.NewMemoryStore()
+	for _, counterpart := range []int{1002, 1004} {
+		if _, _, err := store.CreateChatRoom(1001, counterpart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, businessPartner := range []int{1001, 1002, 1003} {
+		store.PutBusinessPartner(typesMessage.BusinessPartnerWithDetails{
+			BusinessPartner: businessPartner,
+			NickName:        "partner",
+		})
+	}
+
+	l := logger.NewLogger()
+	handler := beego.NewControllerRegister()
+	handler.Add("/user-profile/:businessPartner", &MessageUserProfileController{
+		CustomLogger: l,
+		Store:        store,
+	})
+	handler.InsertFilter("/user-profile/*", beego.BeforeExec, services.AuthenticateFilter(verifier, l))
+	handler.InsertFilter("/user-profile/:businessPartner", beego.BeforeExec, services.ChatRoomCounterpartFilter(store, l))
+	return handler
+}
+
+func get(t *testing.T, handler http.Handler, caller int, businessPartner string) (int, userProfileResponse) {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"business_partner": caller,
+		"exp":              time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(testHS256Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/user-profile/"+businessPartner, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var response userProfileResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func TestGetReturnsProfilesOfSelfAndCounterparts(t *testing.T) {
+	handler := newTestHandler(t)
+
+	for _, businessPartner := range []int{1001, 1002} {
+		status, response := get(t, handler, 1001, fmt.Sprint(businessPartner))
+		if status != http.StatusOK {
+			t.Fatalf("%d: status = %d, want %d", businessPartner, status, http.StatusOK)
+		}
+		if len(response.UserProfile) != 1 || response.UserProfile[0].BusinessPartner != businessPartner {
+			t.Errorf("%d: UserProfile = %+v, want its profile", businessPartner, response.UserProfile)
+		}
+	}
+}
+
+func TestGetReturnsNoProfileForCounterpartWithoutOne(t *testing.T) {
+	handler := newTestHandler(t)
+
+	status, response := get(t, handler, 1001, "1004")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if len(response.UserProfile) != 0 {
+		t.Errorf("UserProfile = %+v, want none", response.UserProfile)
+	}
+}
+
+func TestGetRejectsStrangersAndInvalidIDs(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name            string
+		businessPartner string
+		want            int
+	}{
+		{name: "stranger", businessPartner: "1003", want: http.StatusForbidden},
+		{name: "non-numeric", businessPartner: "abc", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := get(t, handler, 1001, tt.businessPartner); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"data-platform-conversation-kube/config"
-	_ "data-platform-conversation-kube/routers"
+	"data-platform-conversation-kube/routers"
 	"github.com/astaxie/beego"
+	"os"
 )
 
 func main() {
 	conf := config.NewConf()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(conf, os.Args[2:]))
+	}
+
+	routers.Init()
 	beego.Run(conf.SERVER.ServerURL())
 	//beego.Run()
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"data-platform-conversation-kube/config"
+	servicesMigrations "data-platform-conversation-kube/services/migrations"
+	"fmt"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	database "github.com/latonaio/golang-mysql-network-connector"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up          apply every pending migration
+  down [n]    roll back the latest n applied migrations (default 1)
+  status      list migrations and when they were applied`
+
+// migrate runs the migrate subcommand and returns the exit code.
+func migrate(conf *config.Conf, args []string) int {
+	l := logger.NewLogger()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "down":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "down requires a positive number of migrations")
+				return 2
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.NewMySQL(conf.DB)
+	if err != nil {
+		l.Error("%v", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := servicesMigrations.NewMigrator(db)
+	if err != nil {
+		l.Error("%v", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			l.Info("Applied migration %d %s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			l.Error("%v", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			l.Info("Schema is up to date")
+		}
+	case "down":
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			l.Info("Rolled back migration %d %s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			l.Error("%v", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			l.Info("No applied migrations to roll back")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			l.Error("%v", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = *status.AppliedAt
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+	}
+	return 0
+}
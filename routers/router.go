@@ -2,10 +2,23 @@ package routers
 
 import (
 	"data-platform-conversation-kube/config"
+	controllersMessageAdminOutbox "data-platform-conversation-kube/controllers/nessage/admin-outbox"
+	controllersMessageAttachments "data-platform-conversation-kube/controllers/nessage/attachments"
 	"data-platform-conversation-kube/controllers/nessage/connect"
+	controllersMessageCreatesGroup "data-platform-conversation-kube/controllers/nessage/creates-group"
 	"data-platform-conversation-kube/controllers/nessage/creates-room"
 	controllersMessageHistories "data-platform-conversation-kube/controllers/nessage/histories"
+	controllersMessagePresence "data-platform-conversation-kube/controllers/nessage/presence"
+	controllersMessageRooms "data-platform-conversation-kube/controllers/nessage/rooms"
 	controllersMessageUserProfile "data-platform-conversation-kube/controllers/nessage/user-profile"
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	servicesCommands "data-platform-conversation-kube/services/commands"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	servicesOutbox "data-platform-conversation-kube/services/outbox"
+	servicesPresence "data-platform-conversation-kube/services/presence"
+	servicesPreview "data-platform-conversation-kube/services/preview"
+	servicesStorage "data-platform-conversation-kube/services/storage"
 	"github.com/astaxie/beego"
 	"github.com/astaxie/beego/context"
 	"github.com/astaxie/beego/plugins/cors"
@@ -13,7 +26,9 @@ import (
 	database "github.com/latonaio/golang-mysql-network-connector"
 )
 
-func init() {
+// Init connects the backing services, starts the background workers and
+// registers the routes and filters of the API.
+func Init() {
 	l := logger.NewLogger()
 	conf := config.NewConf()
 	db, err := database.NewMySQL(conf.DB)
@@ -21,34 +36,125 @@ func init() {
 		l.Fatal(err.Error())
 	}
 	l.Info("DB connection established")
+	store := services.NewMysqlStore(db)
+
+	tokenVerifier, err := services.NewTokenVerifier(conf.AUTH)
+	if err != nil {
+		l.Fatal(err.Error())
+	}
+
+	broadcaster, err := servicesBroadcast.NewBroadcaster(conf.REDIS)
+	if err != nil {
+		l.Fatal(err.Error())
+	}
+	if conf.REDIS.Enabled() {
+		l.Info("Redis broadcaster connected")
+	}
+
+	events, err := servicesEvents.NewPublisher(conf.RMQ)
+	if err != nil {
+		l.Fatal(err.Error())
+	}
+	if _, ok := events.(*servicesEvents.AMQPPublisher); ok {
+		l.Info("RabbitMQ event publisher connected")
+	}
+
+	outbox := servicesOutbox.NewRelay(store, events, l)
+	outbox.Start()
+
+	storage, err := servicesStorage.NewStorage(conf.ATTACHMENT)
+	if err != nil {
+		l.Fatal(err.Error())
+	}
+
+	preview := servicesPreview.NewWorker(store, storage, l, conf.ATTACHMENT.PreviewMaxDimension())
+	preview.Start(conf.ATTACHMENT.PreviewWorkers())
+
+	attachmentCleaner := servicesStorage.NewCleaner(store, storage, l, conf.ATTACHMENT.UnlinkedTTL())
+	attachmentCleaner.Start()
+
+	presenceStore, err := servicesPresence.NewStore(conf.REDIS)
+	if err != nil {
+		l.Fatal(err.Error())
+	}
+	presence := servicesPresence.NewTracker(presenceStore, store, broadcaster, l)
+	presence.Start()
 
 	messageConnectController := &controllersMessageConnect.MessageConnectController{
 		CustomLogger: l,
-		DB:           db,
+		Store:        store,
+		Broadcaster:  broadcaster,
+		Presence:     presence,
+		Hub:          controllersMessageConnect.NewHub(),
+		MessageConf:  conf.MESSAGE,
+		ServerConf:   conf.SERVER,
+		Events:       events,
 	}
+	if err := messageConnectController.Subscribe(); err != nil {
+		l.Fatal(err.Error())
+	}
+
+	commands := servicesCommands.NewConsumer(conf.RMQ, l)
+	commands.Handle(servicesCommands.PostSystemMessageCommand, messageConnectController.PostSystemMessage)
+	commands.Start()
 
 	messageHistoriesController := &controllersMessageHistories.MessageHistoriesController{
 		CustomLogger: l,
-		DB:           db,
+		Store:        store,
 	}
 
 	messageCreatesRoomController := &controllersMessageCreatesRoom.MessageCreatesRoomController{
 		CustomLogger: l,
-		DB:           db,
+		Store:        store,
+	}
+
+	messageCreatesGroupController := &controllersMessageCreatesGroup.MessageCreatesGroupController{
+		CustomLogger: l,
+		Store:        store,
+	}
+
+	messageRoomsController := &controllersMessageRooms.MessageRoomsController{
+		CustomLogger: l,
+		Store:        store,
+	}
+
+	messagePresenceController := &controllersMessagePresence.MessagePresenceController{
+		CustomLogger: l,
+		Presence:     presence,
+	}
+
+	messageAttachmentsController := &controllersMessageAttachments.MessageAttachmentsController{
+		CustomLogger:   l,
+		Store:          store,
+		Storage:        storage,
+		AttachmentConf: conf.ATTACHMENT,
+		Preview:        preview,
 	}
 
 	messageUserProfileController := &controllersMessageUserProfile.MessageUserProfileController{
 		CustomLogger: l,
-		DB:           db,
+		Store:        store,
+	}
+
+	messageAdminOutboxController := &controllersMessageAdminOutbox.MessageAdminOutboxController{
+		CustomLogger: l,
+		Store:        store,
 	}
 
 	chat := beego.NewNamespace(
 		"/message",
 		beego.NSCond(func(ctx *context.Context) bool { return true }),
 		beego.NSRouter("/creates/room", messageCreatesRoomController),
+		beego.NSRouter("/creates/group", messageCreatesGroupController),
 		beego.NSRouter("/histories/:chatRoom", messageHistoriesController),
 		beego.NSRouter("/user-profile/:businessPartner", messageUserProfileController),
+		beego.NSRouter("/rooms/:businessPartner", messageRoomsController),
+		beego.NSRouter("/presence", messagePresenceController),
+		beego.NSRouter("/attachments/:chatRoom", messageAttachmentsController, "post:Post"),
+		beego.NSRouter("/attachments/:chatRoom/:attachment", messageAttachmentsController, "get:Download"),
+		beego.NSRouter("/attachments/:chatRoom/:attachment/preview", messageAttachmentsController, "get:DownloadPreview"),
 		beego.NSRouter("/connect/:chatRoom/:businessPartner", messageConnectController, "get:Connect"),
+		beego.NSRouter("/admin/outbox", messageAdminOutboxController),
 	)
 
 	beego.AddNamespace(
@@ -65,4 +171,18 @@ func init() {
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
+
+	beego.InsertFilter("/api/conversation/message/attachments/:chatRoom", beego.BeforeStatic, services.LimitRequestBodyFilter(conf.ATTACHMENT.MaxRequestSize()))
+
+	beego.InsertFilter("/api/conversation/message/*", beego.BeforeExec, services.AuthenticateFilter(tokenVerifier, l))
+	beego.InsertFilter("/api/conversation/message/histories/:chatRoom", beego.BeforeExec, services.ChatRoomMemberFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/attachments/:chatRoom", beego.BeforeExec, services.ChatRoomMemberFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/attachments/:chatRoom/:attachment", beego.BeforeExec, services.ChatRoomMemberFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/attachments/:chatRoom/:attachment/preview", beego.BeforeExec, services.ChatRoomMemberFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/user-profile/:businessPartner", beego.BeforeExec, services.ChatRoomCounterpartFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/presence", beego.BeforeExec, services.PresenceCounterpartsFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/rooms/:businessPartner", beego.BeforeExec, services.BusinessPartnerOwnerFilter())
+	beego.InsertFilter("/api/conversation/message/connect/:chatRoom/:businessPartner", beego.BeforeExec, services.BusinessPartnerOwnerFilter())
+	beego.InsertFilter("/api/conversation/message/connect/:chatRoom/:businessPartner", beego.BeforeExec, services.ChatRoomMemberFilter(store, l))
+	beego.InsertFilter("/api/conversation/message/admin/*", beego.BeforeExec, services.AdminFilter(conf.AUTH.AdminBusinessPartners()))
 }
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"data-platform-conversation-kube/config"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/xerrors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const authenticatedBusinessPartnerKey = "AuthenticatedBusinessPartner"
+
+// MaxPresenceBusinessPartners caps how many business partners one presence
+// request may ask about.
+const MaxPresenceBusinessPartners = 100
+
+type TokenVerifier struct {
+	hs256Secret          []byte
+	rs256PublicKey       any
+	businessPartnerClaim string
+}
+
+func NewTokenVerifier(conf *config.AUTH) (*TokenVerifier, error) {
+	verifier := &TokenVerifier{
+		hs256Secret:          conf.HS256Secret(),
+		businessPartnerClaim: conf.BusinessPartnerClaim(),
+	}
+
+	pemKey, err := conf.RS256PublicKey()
+	if err != nil {
+		return nil, xerrors.Errorf("read RS256 public key error: %w", err)
+	}
+	if pemKey != nil {
+		verifier.rs256PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pemKey)
+		if err != nil {
+			return nil, xerrors.Errorf("parse RS256 public key error: %w", err)
+		}
+	}
+
+	if verifier.hs256Secret == nil && verifier.rs256PublicKey == nil {
+		return nil, xerrors.New("neither JWT_HS256_SECRET nor JWT_RS256_PUBLIC_KEY is configured")
+	}
+
+	return verifier, nil
+}
+
+// Verify validates the signature and expiry of the token, which must carry
+// an exp claim, and returns the business partner carried in its claims.
+func (v *TokenVerifier) Verify(tokenString string) (int, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (any, error) {
+			switch token.Method.Alg() {
+			case jwt.SigningMethodHS256.Alg():
+				if v.hs256Secret != nil {
+					return v.hs256Secret, nil
+				}
+			case jwt.SigningMethodRS256.Alg():
+				if v.rs256PublicKey != nil {
+					return v.rs256PublicKey, nil
+				}
+			}
+			return nil, xerrors.Errorf("unexpected signing method: %s", token.Method.Alg())
+		},
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+		}),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	switch businessPartner := claims[v.businessPartnerClaim].(type) {
+	case float64:
+		return int(businessPartner), nil
+	case string:
+		return strconv.Atoi(businessPartner)
+	}
+	return 0, xerrors.Errorf("claim %s is missing", v.businessPartnerClaim)
+}
+
+// AuthenticatedBusinessPartner returns the business partner verified by
+// AuthenticateFilter for the current request.
+func AuthenticatedBusinessPartner(ctx *context.Context) (int, bool) {
+	businessPartner, ok := ctx.Input.GetData(authenticatedBusinessPartnerKey).(int)
+	return businessPartner, ok
+}
+
+// AuthenticateFilter rejects requests without a valid JWT. WebSocket clients
+// cannot set headers, so the token is also accepted as the token query
+// parameter.
+func AuthenticateFilter(verifier *TokenVerifier, l *logger.Logger) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		if ctx.Input.Method() == http.MethodOptions {
+			return
+		}
+
+		tokenString := strings.TrimPrefix(ctx.Input.Header("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = ctx.Input.Query("token")
+		}
+		if tokenString == "" {
+			abortWithStatus(ctx, http.StatusUnauthorized, "Unauthorized", "authorization token is required")
+			return
+		}
+
+		businessPartner, err := verifier.Verify(tokenString)
+		if err != nil {
+			l.Warn("JWT verification failed: %v", err)
+			abortWithStatus(ctx, http.StatusUnauthorized, "Unauthorized", "invalid authorization token")
+			return
+		}
+
+		ctx.Input.SetData(authenticatedBusinessPartnerKey, businessPartner)
+	}
+}
+
+// ChatRoomMemberFilter rejects callers that do not belong to :chatRoom.
+func ChatRoomMemberFilter(store RoomStore, l *logger.Logger) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		businessPartner, ok := AuthenticatedBusinessPartner(ctx)
+		if !ok {
+			return
+		}
+
+		chatRoom := ctx.Input.Param(":chatRoom")
+		isMember, err := store.IsChatRoomMember(chatRoom, businessPartner)
+		if err != nil {
+			l.Error("IsChatRoomMember error: %v", err)
+			abortWithStatus(ctx, http.StatusInternalServerError, "InternalServerError", err.Error())
+			return
+		}
+		if !isMember {
+			abortWithStatus(
+				ctx,
+				http.StatusForbidden,
+				"Forbidden",
+				fmt.Sprintf("business partner %d is not a member of chat room %s", businessPartner, chatRoom),
+			)
+		}
+	}
+}
+
+// BusinessPartnerOwnerFilter rejects callers whose :businessPartner path
+// segment is not their own.
+func BusinessPartnerOwnerFilter() beego.FilterFunc {
+	return func(ctx *context.Context) {
+		businessPartner, ok := AuthenticatedBusinessPartner(ctx)
+		if !ok {
+			return
+		}
+
+		if ctx.Input.Param(":businessPartner") != strconv.Itoa(businessPartner) {
+			abortWithStatus(
+				ctx,
+				http.StatusForbidden,
+				"Forbidden",
+				fmt.Sprintf("business partner %d cannot act as %s", businessPartner, ctx.Input.Param(":businessPartner")),
+			)
+		}
+	}
+}
+
+// ChatRoomCounterpartFilter lets callers read :businessPartner only when it is
+// themselves or somebody they share a chat room with.
+func ChatRoomCounterpartFilter(store RoomStore, l *logger.Logger) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		businessPartner, ok := AuthenticatedBusinessPartner(ctx)
+		if !ok {
+			return
+		}
+
+		counterpart, err := strconv.Atoi(ctx.Input.Param(":businessPartner"))
+		if err != nil {
+			abortWithStatus(ctx, http.StatusBadRequest, "BadRequest", "businessPartner must be a number")
+			return
+		}
+		if counterpart == businessPartner {
+			return
+		}
+
+		sharesChatRoom, err := store.SharesChatRoom(businessPartner, counterpart)
+		if err != nil {
+			l.Error("SharesChatRoom error: %v", err)
+			abortWithStatus(ctx, http.StatusInternalServerError, "InternalServerError", err.Error())
+			return
+		}
+		if !sharesChatRoom {
+			abortWithStatus(
+				ctx,
+				http.StatusForbidden,
+				"Forbidden",
+				fmt.Sprintf("business partner %d shares no chat room with %d", businessPartner, counterpart),
+			)
+		}
+	}
+}
+
+// PresenceCounterpartsFilter lets callers read the presence of the
+// businessPartners query parameter only when each is themselves or somebody
+// they share a chat room with. Lists longer than MaxPresenceBusinessPartners
+// are rejected before the store is asked.
+func PresenceCounterpartsFilter(store RoomStore, l *logger.Logger) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		businessPartner, ok := AuthenticatedBusinessPartner(ctx)
+		if !ok {
+			return
+		}
+
+		listed := 0
+		var counterparts []int
+		for _, v := range strings.Split(ctx.Input.Query("businessPartners"), ",") {
+			if strings.TrimSpace(v) == "" {
+				continue
+			}
+			listed++
+			if listed > MaxPresenceBusinessPartners {
+				abortWithStatus(
+					ctx,
+					http.StatusBadRequest,
+					"BadRequest",
+					fmt.Sprintf("businessPartners must list 1 to %d business partners", MaxPresenceBusinessPartners),
+				)
+				return
+			}
+			counterpart, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				abortWithStatus(ctx, http.StatusBadRequest, "BadRequest", fmt.Sprintf("invalid business partner %s", v))
+				return
+			}
+			if counterpart != businessPartner {
+				counterparts = append(counterparts, counterpart)
+			}
+		}
+		if len(counterparts) == 0 {
+			return
+		}
+
+		sharing, err := store.CounterpartsSharingChatRoom(businessPartner, counterparts)
+		if err != nil {
+			l.Error("CounterpartsSharingChatRoom error: %v", err)
+			abortWithStatus(ctx, http.StatusInternalServerError, "InternalServerError", err.Error())
+			return
+		}
+		for _, counterpart := range counterparts {
+			if !sharing[counterpart] {
+				abortWithStatus(
+					ctx,
+					http.StatusForbidden,
+					"Forbidden",
+					fmt.Sprintf("business partner %d shares no chat room with %d", businessPartner, counterpart),
+				)
+				return
+			}
+		}
+	}
+}
+
+// AdminFilter rejects callers that are not listed as administrators.
+func AdminFilter(admins []int) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		businessPartner, ok := AuthenticatedBusinessPartner(ctx)
+		if !ok {
+			return
+		}
+
+		for _, admin := range admins {
+			if admin == businessPartner {
+				return
+			}
+		}
+		abortWithStatus(
+			ctx,
+			http.StatusForbidden,
+			"Forbidden",
+			fmt.Sprintf("business partner %d is not an administrator", businessPartner),
+		)
+	}
+}
+
+func abortWithStatus(
+	ctx *context.Context,
+	statusCode int,
+	name string,
+	message string,
+) {
+	ctx.Output.SetStatus(statusCode)
+	ctx.Output.JSON(ResponseData{
+		StatusCode: statusCode,
+		Name:       name,
+		Message:    message,
+	}, false, false)
+}
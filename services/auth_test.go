@@ -0,0 +1,385 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"data-platform-conversation-kube/config"
+	"encoding/pem"
+	"github.com/astaxie/beego/context"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHS256Secret = "test-secret"
+
+func newTestVerifier(t *testing.T, hs256Secret string, rs256Key *rsa.PrivateKey) *TokenVerifier {
+	t.Helper()
+
+	t.Setenv("JWT_HS256_SECRET", hs256Secret)
+	t.Setenv("JWT_RS256_PUBLIC_KEY", "")
+	t.Setenv("JWT_RS256_PUBLIC_KEY_PATH", "")
+	t.Setenv("JWT_BUSINESS_PARTNER_CLAIM", "")
+	if rs256Key != nil {
+		der, err := x509.MarshalPKIXPublicKey(&rs256Key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("JWT_RS256_PUBLIC_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	}
+
+	verifier, err := NewTokenVerifier(config.NewConf().AUTH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenVerifierVerify(t *testing.T) {
+	rs256Key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, testHS256Secret, rs256Key)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"business_partner": 1001,
+			"exp":              time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "HS256",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), valid())
+			},
+			want: 1001,
+		},
+		{
+			name: "RS256",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodRS256, rs256Key, valid())
+			},
+			want: 1001,
+		},
+		{
+			name: "business partner as string",
+			token: func() string {
+				claims := valid()
+				claims["business_partner"] = "1002"
+				return signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), claims)
+			},
+			want: 1002,
+		},
+		{
+			name: "wrong algorithm",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodHS384, []byte(testHS256Secret), valid())
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong HS256 secret",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodHS256, []byte("other-secret"), valid())
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong RS256 key",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodRS256, otherKey, valid())
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := valid()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing exp",
+			token: func() string {
+				claims := valid()
+				delete(claims, "exp")
+				return signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing business partner",
+			token: func() string {
+				claims := valid()
+				delete(claims, "business_partner")
+				return signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed",
+			token: func() string {
+				return "not-a-token"
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.Verify(tt.token())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Verify() = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierRejectsUnconfiguredAlgorithm(t *testing.T) {
+	rs256Key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, "", rs256Key)
+
+	token := signToken(t, jwt.SigningMethodHS256, []byte(testHS256Secret), jwt.MapClaims{
+		"business_partner": 1001,
+		"exp":              time.Now().Add(time.Hour).Unix(),
+	})
+	if _, err := verifier.Verify(token); err == nil {
+		t.Fatal("Verify() accepted HS256 without a configured secret")
+	}
+}
+
+// runFilter runs filter for a request whose path parameters are params. A
+// business partner of 0 leaves the request unauthenticated. It returns the
+// status written by the filter, or 0 when the request was let through.
+func runFilter(t *testing.T, filter func(*context.Context), businessPartner int, params map[string]string) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	ctx := context.NewContext()
+	ctx.Reset(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	for key, value := range params {
+		ctx.Input.SetParam(key, value)
+	}
+	if businessPartner != 0 {
+		ctx.Input.SetData(authenticatedBusinessPartnerKey, businessPartner)
+	}
+
+	filter(ctx)
+	if !ctx.ResponseWriter.Started {
+		return 0
+	}
+	return recorder.Code
+}
+
+func TestChatRoomMemberFilter(t *testing.T) {
+	store := NewMemoryStore()
+	direct, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := store.CreateGroupChatRoom(1003, []int{1003, 1004}, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := ChatRoomMemberFilter(store, logger.NewLogger())
+
+	tests := []struct {
+		name            string
+		businessPartner int
+		chatRoom        string
+		want            int
+	}{
+		{name: "direct room creator", businessPartner: 1001, chatRoom: *direct},
+		{name: "direct room partner", businessPartner: 1002, chatRoom: *direct},
+		{name: "group participant", businessPartner: 1004, chatRoom: *group},
+		{name: "outsider", businessPartner: 1003, chatRoom: *direct, want: http.StatusForbidden},
+		{name: "unknown room", businessPartner: 1001, chatRoom: "unknown", want: http.StatusForbidden},
+		{name: "unauthenticated", chatRoom: *direct},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runFilter(t, filter, tt.businessPartner, map[string]string{":chatRoom": tt.chatRoom})
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBusinessPartnerOwnerFilter(t *testing.T) {
+	filter := BusinessPartnerOwnerFilter()
+
+	tests := []struct {
+		name            string
+		businessPartner int
+		param           string
+		want            int
+	}{
+		{name: "owner", businessPartner: 1001, param: "1001"},
+		{name: "somebody else", businessPartner: 1001, param: "1002", want: http.StatusForbidden},
+		{name: "not a number", businessPartner: 1001, param: "abc", want: http.StatusForbidden},
+		{name: "unauthenticated", param: "1002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runFilter(t, filter, tt.businessPartner, map[string]string{":businessPartner": tt.param})
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatRoomCounterpartFilter(t *testing.T) {
+	store := NewMemoryStore()
+	if _, _, err := store.CreateChatRoom(1001, 1002); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateGroupChatRoom(1001, []int{1001, 1003}, "group"); err != nil {
+		t.Fatal(err)
+	}
+	filter := ChatRoomCounterpartFilter(store, logger.NewLogger())
+
+	tests := []struct {
+		name            string
+		businessPartner int
+		param           string
+		want            int
+	}{
+		{name: "self", businessPartner: 1004, param: "1004"},
+		{name: "direct room counterpart", businessPartner: 1002, param: "1001"},
+		{name: "group room counterpart", businessPartner: 1003, param: "1001"},
+		{name: "no shared room", businessPartner: 1002, param: "1003", want: http.StatusForbidden},
+		{name: "not a number", businessPartner: 1001, param: "abc", want: http.StatusBadRequest},
+		{name: "unauthenticated", param: "1003"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runFilter(t, filter, tt.businessPartner, map[string]string{":businessPartner": tt.param})
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresenceCounterpartsFilter(t *testing.T) {
+	store := NewMemoryStore()
+	if _, _, err := store.CreateChatRoom(1001, 1002); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateGroupChatRoom(1001, []int{1001, 1003}, "group"); err != nil {
+		t.Fatal(err)
+	}
+	filter := PresenceCounterpartsFilter(store, logger.NewLogger())
+
+	tests := []struct {
+		name             string
+		businessPartner  int
+		businessPartners string
+		want             int
+	}{
+		{name: "self", businessPartner: 1004, businessPartners: "1004"},
+		{name: "every counterpart", businessPartner: 1001, businessPartners: "1001, 1002,1003"},
+		{name: "one without a shared room", businessPartner: 1002, businessPartners: "1001,1003", want: http.StatusForbidden},
+		{name: "not a number", businessPartner: 1001, businessPartners: "1002,abc", want: http.StatusBadRequest},
+		{name: "too many", businessPartner: 1001, businessPartners: strings.Repeat("1002,", MaxPresenceBusinessPartners) + "1003", want: http.StatusBadRequest},
+		{name: "unauthenticated", businessPartners: "1003"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Input.Query reads parameters before the query string.
+			got := runFilter(t, filter, tt.businessPartner, map[string]string{"businessPartners": tt.businessPartners})
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// countingRoomStore counts the shared-room lookups made through it.
+type countingRoomStore struct {
+	*MemoryStore
+	lookups int
+}
+
+func (s *countingRoomStore) SharesChatRoom(businessPartner int, counterpart int) (bool, error) {
+	s.lookups++
+	return s.MemoryStore.SharesChatRoom(businessPartner, counterpart)
+}
+
+func (s *countingRoomStore) CounterpartsSharingChatRoom(businessPartner int, counterparts []int) (map[int]bool, error) {
+	s.lookups++
+	return s.MemoryStore.CounterpartsSharingChatRoom(businessPartner, counterparts)
+}
+
+func TestPresenceCounterpartsFilterLooksUpRoomsOnce(t *testing.T) {
+	store := &countingRoomStore{MemoryStore: NewMemoryStore()}
+	for counterpart := 1002; counterpart < 1002+MaxPresenceBusinessPartners; counterpart++ {
+		if _, _, err := store.CreateChatRoom(1001, counterpart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := PresenceCounterpartsFilter(store, logger.NewLogger())
+
+	counterparts := make([]string, MaxPresenceBusinessPartners)
+	for i := range counterparts {
+		counterparts[i] = strconv.Itoa(1002 + i)
+	}
+	if got := runFilter(t, filter, 1001, map[string]string{"businessPartners": strings.Join(counterparts, ",")}); got != 0 {
+		t.Fatalf("status = %d, want the request let through", got)
+	}
+	if store.lookups != 1 {
+		t.Errorf("%d store lookups for %d business partners, want 1", store.lookups, len(counterparts))
+	}
+
+	store.lookups = 0
+	tooMany := strings.Join(append(counterparts, "1001"), ",")
+	if got := runFilter(t, filter, 1001, map[string]string{"businessPartners": tooMany}); got != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if store.lookups != 0 {
+		t.Errorf("%d store lookups for an oversized list, want none", store.lookups)
+	}
+}
@@ -0,0 +1,84 @@
+package servicesBroadcast
+
+import (
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+)
+
+// Recipients selects the business partners of a room that receive an event.
+// An empty BusinessPartners means everybody in the room, minus
+// ExcludedBusinessPartners.
+type Recipients struct {
+	BusinessPartners         []int `json:"businessPartners,omitempty"`
+	ExcludedBusinessPartners []int `json:"excludedBusinessPartners,omitempty"`
+}
+
+func Everyone() Recipients {
+	return Recipients{}
+}
+
+func Only(businessPartners ...int) Recipients {
+	return Recipients{BusinessPartners: businessPartners}
+}
+
+func Except(businessPartners ...int) Recipients {
+	return Recipients{ExcludedBusinessPartners: businessPartners}
+}
+
+// Envelope is a single event addressed to the connections of a chat room.
+type Envelope struct {
+	ChatRoom   string          `json:"chatRoom"`
+	Recipients Recipients      `json:"recipients"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type Handler func(envelope Envelope)
+
+// Broadcaster fans room events out to every pod that holds connections for
+// the room. Publish never writes to a websocket itself; delivery happens in
+// the handlers registered with Subscribe.
+type Broadcaster interface {
+	Publish(chatRoom string, recipients Recipients, payload any) error
+	Subscribe(handler Handler) error
+	Close() error
+}
+
+func NewBroadcaster(conf *config.REDIS) (Broadcaster, error) {
+	if !conf.Enabled() {
+		return NewMemoryBroadcaster(), nil
+	}
+	return NewRedisBroadcaster(conf)
+}
+
+func (r Recipients) Includes(businessPartner int) bool {
+	for _, v := range r.ExcludedBusinessPartners {
+		if v == businessPartner {
+			return false
+		}
+	}
+	if len(r.BusinessPartners) == 0 {
+		return true
+	}
+	for _, v := range r.BusinessPartners {
+		if v == businessPartner {
+			return true
+		}
+	}
+	return false
+}
+
+func newEnvelope(
+	chatRoom string,
+	recipients Recipients,
+	payload any,
+) (*Envelope, error) {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		ChatRoom:   chatRoom,
+		Recipients: recipients,
+		Payload:    rawPayload,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package servicesBroadcast
+
+import "sync"
+
+// MemoryBroadcaster delivers events to handlers in the same process. It is
+// the default for a single-node deployment.
+type MemoryBroadcaster struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewMemoryBroadcaster() *MemoryBroadcaster {
+	return &MemoryBroadcaster{}
+}
+
+func (b *MemoryBroadcaster) Publish(
+	chatRoom string,
+	recipients Recipients,
+	payload any,
+) error {
+	envelope, err := newEnvelope(chatRoom, recipients, payload)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(*envelope)
+	}
+	return nil
+}
+
+func (b *MemoryBroadcaster) Subscribe(handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *MemoryBroadcaster) Close() error {
+	return nil
+}
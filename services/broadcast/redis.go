@@ -0,0 +1,97 @@
+package servicesBroadcast
+
+import (
+	"context"
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/xerrors"
+	"strings"
+	"sync"
+)
+
+const channelPrefix = "data-platform-conversation:room:"
+
+// RedisBroadcaster publishes every event to a per-room Redis channel so that
+// all replicas receive it, including the publishing one.
+type RedisBroadcaster struct {
+	client  *redis.Client
+	mu      sync.Mutex
+	pubSubs []*redis.PubSub
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewRedisBroadcaster(conf *config.REDIS) (*RedisBroadcaster, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.URL(),
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.Ping(ctx).Err(); err != nil {
+		cancel()
+		return nil, xerrors.Errorf("redis ping error: %w", err)
+	}
+
+	return &RedisBroadcaster{
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (b *RedisBroadcaster) Publish(
+	chatRoom string,
+	recipients Recipients,
+	payload any,
+) error {
+	envelope, err := newEnvelope(chatRoom, recipients, payload)
+	if err != nil {
+		return err
+	}
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(b.ctx, channelPrefix+chatRoom, message).Err()
+}
+
+func (b *RedisBroadcaster) Subscribe(handler Handler) error {
+	pubSub := b.client.PSubscribe(b.ctx, channelPrefix+"*")
+	if _, err := pubSub.Receive(b.ctx); err != nil {
+		pubSub.Close()
+		return xerrors.Errorf("redis subscribe error: %w", err)
+	}
+
+	b.mu.Lock()
+	b.pubSubs = append(b.pubSubs, pubSub)
+	b.mu.Unlock()
+
+	go func() {
+		for message := range pubSub.Channel() {
+			var envelope Envelope
+			if err := json.Unmarshal([]byte(message.Payload), &envelope); err != nil {
+				continue
+			}
+			if envelope.ChatRoom == "" {
+				envelope.ChatRoom = strings.TrimPrefix(message.Channel, channelPrefix)
+			}
+			handler(envelope)
+		}
+	}()
+
+	return nil
+}
+
+func (b *RedisBroadcaster) Close() error {
+	b.cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pubSub := range b.pubSubs {
+		pubSub.Close()
+	}
+	return b.client.Close()
+}
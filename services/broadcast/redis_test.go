@@ -0,0 +1,135 @@
+package servicesBroadcast
+
+import (
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRedisConf points the Redis configuration at a fresh in-process
+// Redis.
+func newTestRedisConf(t *testing.T) (*config.REDIS, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	host, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDIS_HOST", host)
+	t.Setenv("REDIS_PORT", port)
+	t.Setenv("REDIS_PASSWORD", "")
+	t.Setenv("REDIS_DB", "")
+	return config.NewConf().REDIS, server
+}
+
+func newTestRedisBroadcaster(t *testing.T, conf *config.REDIS) (*RedisBroadcaster, chan Envelope) {
+	t.Helper()
+
+	broadcaster, err := NewRedisBroadcaster(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broadcaster.Close() })
+
+	received := make(chan Envelope, 16)
+	if err := broadcaster.Subscribe(func(envelope Envelope) {
+		received <- envelope
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return broadcaster, received
+}
+
+func receive(t *testing.T, received chan Envelope) Envelope {
+	t.Helper()
+
+	select {
+	case envelope := <-received:
+		return envelope
+	case <-time.After(2 * time.Second):
+		t.Fatal("no envelope received")
+	}
+	return Envelope{}
+}
+
+// Two pods share one Redis: an event published on one reaches the
+// subscribers of both.
+func TestRedisBroadcasterDeliversAcrossPods(t *testing.T) {
+	conf, _ := newTestRedisConf(t)
+	podA, receivedA := newTestRedisBroadcaster(t, conf)
+	_, receivedB := newTestRedisBroadcaster(t, conf)
+
+	payload := map[string]any{"type": "ReceivedMessage", "messageID": "m1"}
+	if err := podA.Publish("room-1", Only(1002), payload); err != nil {
+		t.Fatal(err)
+	}
+
+	for pod, received := range map[string]chan Envelope{"A": receivedA, "B": receivedB} {
+		envelope := receive(t, received)
+		if envelope.ChatRoom != "room-1" {
+			t.Errorf("pod %s: chat room = %q, want room-1", pod, envelope.ChatRoom)
+		}
+		if !reflect.DeepEqual(envelope.Recipients, Only(1002)) {
+			t.Errorf("pod %s: recipients = %+v, want only 1002", pod, envelope.Recipients)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(envelope.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, payload) {
+			t.Errorf("pod %s: payload = %v, want %v", pod, got, payload)
+		}
+	}
+}
+
+func TestRedisBroadcasterKeepsRoomsApart(t *testing.T) {
+	conf, _ := newTestRedisConf(t)
+	podA, _ := newTestRedisBroadcaster(t, conf)
+	_, receivedB := newTestRedisBroadcaster(t, conf)
+
+	for _, chatRoom := range []string{"room-1", "room-2"} {
+		if err := podA.Publish(chatRoom, Everyone(), map[string]any{"chatRoom": chatRoom}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"room-1", "room-2"} {
+		if got := receive(t, receivedB).ChatRoom; got != want {
+			t.Errorf("chat room = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestNewRedisBroadcasterFailsWithoutRedis(t *testing.T) {
+	conf, server := newTestRedisConf(t)
+	server.Close()
+
+	if _, err := NewRedisBroadcaster(conf); err == nil {
+		t.Fatal("NewRedisBroadcaster() succeeded without Redis")
+	}
+}
+
+func TestNewBroadcaster(t *testing.T) {
+	t.Setenv("REDIS_HOST", "")
+	broadcaster, err := NewBroadcaster(config.NewConf().REDIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := broadcaster.(*MemoryBroadcaster); !ok {
+		t.Errorf("NewBroadcaster() without Redis = %T, want *MemoryBroadcaster", broadcaster)
+	}
+
+	conf, _ := newTestRedisConf(t)
+	broadcaster, err = NewBroadcaster(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broadcaster.Close()
+	if _, ok := broadcaster.(*RedisBroadcaster); !ok {
+		t.Errorf("NewBroadcaster() with Redis = %T, want *RedisBroadcaster", broadcaster)
+	}
+}
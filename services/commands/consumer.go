@@ -0,0 +1,166 @@
+package servicesCommands
+
+import (
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+	"errors"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+const (
+	prefetchCount = 10
+	// retryDelay slows down redelivery of commands that failed for a
+	// transient reason, such as the database being unavailable.
+	retryDelay     = time.Second
+	reconnectDelay = 5 * time.Second
+)
+
+// ErrMalformedCommand marks commands that can never succeed. They are
+// dead-lettered instead of being retried.
+var ErrMalformedCommand = xerrors.New("malformed command")
+
+// Handler processes the raw body of one command. Errors wrapping
+// ErrMalformedCommand dead-letter the command; any other error requeues it.
+type Handler func(body []byte) error
+
+// Consumer reads commands from RMQ.QueueFrom() and dispatches them by their
+// "command" field.
+type Consumer struct {
+	url             string
+	queue           string
+	deadLetterQueue string
+	handlers        map[string]Handler
+	customLogger    *logger.Logger
+}
+
+func NewConsumer(conf *config.RMQ, l *logger.Logger) *Consumer {
+	consumer := &Consumer{
+		handlers:     make(map[string]Handler),
+		customLogger: l,
+	}
+	if conf.Enabled() {
+		consumer.url = conf.URL()
+		consumer.queue = conf.QueueFrom()
+		consumer.deadLetterQueue = conf.QueueDeadLetter()
+	}
+	return consumer
+}
+
+func (c *Consumer) Handle(command string, handler Handler) {
+	c.handlers[command] = handler
+}
+
+// Start consumes in the background and reconnects whenever the connection is
+// lost. It does nothing when RabbitMQ or the queue is not configured.
+func (c *Consumer) Start() {
+	if c.url == "" || c.queue == "" {
+		return
+	}
+	go func() {
+		for {
+			err := c.consume()
+			c.customLogger.Error("Command consumer stopped: %v", err)
+			time.Sleep(reconnectDelay)
+		}
+	}()
+}
+
+func (c *Consumer) consume() error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := channel.Qos(prefetchCount, 0, false); err != nil {
+		return err
+	}
+	if _, err := channel.QueueDeclare(c.queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if c.deadLetterQueue != "" {
+		if _, err := channel.QueueDeclare(c.deadLetterQueue, true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+
+	deliveries, err := channel.Consume(c.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	c.customLogger.Info("Consuming commands from %s", c.queue)
+
+	for delivery := range deliveries {
+		c.process(channel, delivery)
+	}
+	return xerrors.New("delivery channel closed")
+}
+
+func (c *Consumer) process(channel *amqp.Channel, delivery amqp.Delivery) {
+	err := c.dispatch(delivery.Body)
+	switch {
+	case err == nil:
+		delivery.Ack(false)
+	case errors.Is(err, ErrMalformedCommand):
+		c.customLogger.Warn("Dead-lettering command: %v", err)
+		c.deadLetter(channel, delivery, err)
+	default:
+		c.customLogger.Error("Command failed, requeueing: %v", err)
+		time.Sleep(retryDelay)
+		delivery.Nack(false, true)
+	}
+}
+
+// dispatch runs the handler of the command. A panicking handler is treated
+// like a malformed command so one bad message cannot take the pod down.
+func (c *Consumer) dispatch(body []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = xerrors.Errorf("handler panicked: %v: %w", r, ErrMalformedCommand)
+		}
+	}()
+
+	var envelope struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return xerrors.Errorf("%v: %w", err, ErrMalformedCommand)
+	}
+	handler, ok := c.handlers[envelope.Command]
+	if !ok {
+		return xerrors.Errorf("unknown command %q: %w", envelope.Command, ErrMalformedCommand)
+	}
+	return handler(body)
+}
+
+func (c *Consumer) deadLetter(channel *amqp.Channel, delivery amqp.Delivery, reason error) {
+	if c.deadLetterQueue == "" {
+		delivery.Nack(false, false)
+		return
+	}
+
+	err := channel.Publish("", c.deadLetterQueue, false, false, amqp.Publishing{
+		ContentType:  delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    delivery.MessageId,
+		Timestamp:    time.Now(),
+		Headers: amqp.Table{
+			"x-error":          reason.Error(),
+			"x-original-queue": c.queue,
+		},
+		Body: delivery.Body,
+	})
+	if err != nil {
+		c.customLogger.Error("Failed to dead-letter command: %v", err)
+		delivery.Nack(false, false)
+		return
+	}
+	delivery.Ack(false)
+}
@@ -0,0 +1,64 @@
+package servicesCommands
+
+import (
+	"bytes"
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"text/template"
+)
+
+const PostSystemMessageCommand = "PostSystemMessage"
+
+// MaxCommandIDLength is the length of the MessageID column the command ID is
+// stored in.
+const MaxCommandIDLength = 64
+
+// PostSystemMessage posts a message from another service, such as
+// "Delivery 1234 shipped", into a room. The room is either given directly or
+// as the two business partners of a direct room, which is created if needed.
+// Template is a text/template rendered with Payload. CommandID doubles as the
+// MessageID, so a redelivered command does not post twice.
+type PostSystemMessage struct {
+	Command          string         `json:"command"`
+	CommandID        string         `json:"commandID"`
+	ChatRoom         string         `json:"chatRoom"`
+	BusinessPartners []int          `json:"businessPartners"`
+	Template         string         `json:"template"`
+	Payload          map[string]any `json:"payload"`
+}
+
+func ParsePostSystemMessage(body []byte) (*PostSystemMessage, error) {
+	var command PostSystemMessage
+	if err := json.Unmarshal(body, &command); err != nil {
+		return nil, xerrors.Errorf("%v: %w", err, ErrMalformedCommand)
+	}
+	if command.CommandID == "" {
+		return nil, xerrors.Errorf("commandID is required: %w", ErrMalformedCommand)
+	}
+	if len(command.CommandID) > MaxCommandIDLength {
+		return nil, xerrors.Errorf("commandID must be at most %d bytes: %w", MaxCommandIDLength, ErrMalformedCommand)
+	}
+	if command.Template == "" {
+		return nil, xerrors.Errorf("template is required: %w", ErrMalformedCommand)
+	}
+	if command.ChatRoom == "" {
+		if len(command.BusinessPartners) != 2 || command.BusinessPartners[0] == command.BusinessPartners[1] {
+			return nil, xerrors.Errorf("chatRoom or two distinct businessPartners are required: %w", ErrMalformedCommand)
+		}
+	}
+	return &command, nil
+}
+
+// Render executes the template with the payload. Keys missing from the
+// payload are an error rather than "<no value>" in the room.
+func (command *PostSystemMessage) Render() (string, error) {
+	tmpl, err := template.New(command.CommandID).Option("missingkey=error").Parse(command.Template)
+	if err != nil {
+		return "", xerrors.Errorf("%v: %w", err, ErrMalformedCommand)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, command.Payload); err != nil {
+		return "", xerrors.Errorf("%v: %w", err, ErrMalformedCommand)
+	}
+	return content.String(), nil
+}
@@ -0,0 +1,125 @@
+package servicesCommands
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePostSystemMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantMalformed bool
+	}{
+		{
+			name: "chat room",
+			body: `{"command":"PostSystemMessage","commandID":"c1","chatRoom":"r1","template":"hi"}`,
+		},
+		{
+			name: "business partners",
+			body: `{"command":"PostSystemMessage","commandID":"c1","businessPartners":[1001,1002],"template":"hi"}`,
+		},
+		{
+			name: "longest commandID",
+			body: `{"command":"PostSystemMessage","commandID":"` + strings.Repeat("c", MaxCommandIDLength) + `","chatRoom":"r1","template":"hi"}`,
+		},
+		{
+			name:          "not JSON",
+			body:          `{`,
+			wantMalformed: true,
+		},
+		{
+			name:          "missing commandID",
+			body:          `{"command":"PostSystemMessage","chatRoom":"r1","template":"hi"}`,
+			wantMalformed: true,
+		},
+		{
+			name:          "commandID too long",
+			body:          `{"command":"PostSystemMessage","commandID":"` + strings.Repeat("c", MaxCommandIDLength+1) + `","chatRoom":"r1","template":"hi"}`,
+			wantMalformed: true,
+		},
+		{
+			name:          "missing template",
+			body:          `{"command":"PostSystemMessage","commandID":"c1","chatRoom":"r1"}`,
+			wantMalformed: true,
+		},
+		{
+			name:          "one business partner",
+			body:          `{"command":"PostSystemMessage","commandID":"c1","businessPartners":[1001],"template":"hi"}`,
+			wantMalformed: true,
+		},
+		{
+			name:          "same business partner twice",
+			body:          `{"command":"PostSystemMessage","commandID":"c1","businessPartners":[1001,1001],"template":"hi"}`,
+			wantMalformed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePostSystemMessage([]byte(tt.body))
+			if tt.wantMalformed {
+				if !errors.Is(err, ErrMalformedCommand) {
+					t.Fatalf("ParsePostSystemMessage() error = %v, want ErrMalformedCommand", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePostSystemMessage() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestPostSystemMessageRender(t *testing.T) {
+	command := &PostSystemMessage{
+		CommandID: "c1",
+		Template:  "Delivery {{.delivery}} shipped",
+		Payload:   map[string]any{"delivery": 1234},
+	}
+	content, err := command.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Delivery 1234 shipped" {
+		t.Errorf("Render() = %q", content)
+	}
+
+	command.Payload = map[string]any{}
+	if _, err := command.Render(); !errors.Is(err, ErrMalformedCommand) {
+		t.Errorf("Render() with a missing key error = %v, want ErrMalformedCommand", err)
+	}
+}
+
+func TestConsumerDispatch(t *testing.T) {
+	transient := errors.New("database unavailable")
+	consumer := &Consumer{handlers: map[string]Handler{
+		"Ok":     func([]byte) error { return nil },
+		"Fail":   func([]byte) error { return transient },
+		"Panics": func([]byte) error { panic("boom") },
+	}}
+
+	tests := []struct {
+		name          string
+		body          string
+		wantErr       error
+		wantMalformed bool
+	}{
+		{name: "handled", body: `{"command":"Ok"}`},
+		{name: "transient failure", body: `{"command":"Fail"}`, wantErr: transient},
+		{name: "panic", body: `{"command":"Panics"}`, wantMalformed: true},
+		{name: "unknown command", body: `{"command":"Unknown"}`, wantMalformed: true},
+		{name: "not JSON", body: `nope`, wantMalformed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := consumer.dispatch([]byte(tt.body))
+			if errors.Is(err, ErrMalformedCommand) != tt.wantMalformed {
+				t.Fatalf("dispatch() error = %v, malformed want %v", err, tt.wantMalformed)
+			}
+			if !tt.wantMalformed && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("dispatch() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/base64"
+	"golang.org/x/xerrors"
+	"strings"
+)
+
+const (
+	DefaultHistoriesLimit = 50
+	MaxHistoriesLimit     = 200
+)
+
+const cursorSeparator = "|"
+
+func EncodeHistoryCursor(cursor *typesMessage.HistoryCursor) *string {
+	if cursor == nil {
+		return nil
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(
+		[]byte(cursor.SentAt + cursorSeparator + cursor.MessageID),
+	)
+	return &encoded
+}
+
+func DecodeHistoryCursor(encoded string) (*typesMessage.HistoryCursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid cursor: %w", err)
+	}
+	sentAt, messageID, found := strings.Cut(string(decoded), cursorSeparator)
+	if !found || sentAt == "" || messageID == "" {
+		return nil, xerrors.Errorf("invalid cursor: %s", encoded)
+	}
+	return &typesMessage.HistoryCursor{
+		SentAt:    sentAt,
+		MessageID: messageID,
+	}, nil
+}
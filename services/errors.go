@@ -0,0 +1,45 @@
+package services
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrMessageNotFound   = xerrors.New("message not found")
+	ErrNotMessageSender  = xerrors.New("only the sender can change the message")
+	ErrEditWindowExpired = xerrors.New("edit window has expired")
+	ErrInvalidScope      = xerrors.New("scope must be self or everyone")
+	ErrReplyToNotFound   = xerrors.New("replyTo must reference a message in the same chat room")
+	ErrInvalidEmoji      = xerrors.New("emoji must be 1 to 32 bytes")
+	ErrAttachmentInvalid = xerrors.New("attachments must be unsent uploads of the sender in the same chat room")
+	ErrAttachmentMissing = xerrors.New("attachment not found")
+	ErrMessageIDConflict = xerrors.New("messageID is already used by another sender or chat room")
+	ErrChatRoomNotFound  = xerrors.New("chat room not found")
+)
+
+const (
+	mysqlErrDuplicateEntry = 1062
+	mysqlErrDataTooLong    = 1406
+)
+
+// IsInvalidDataError reports whether MySQL rejected the written values
+// themselves, such as a duplicate key or a value too long for its column.
+// Retrying such a write can never succeed.
+func IsInvalidDataError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case mysqlErrDuplicateEntry, mysqlErrDataTooLong:
+		return true
+	}
+	return false
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/xerrors"
+	"testing"
+)
+
+func TestIsInvalidDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062}, want: true},
+		{name: "data too long", err: &mysql.MySQLError{Number: 1406}, want: true},
+		{name: "wrapped", err: xerrors.Errorf("insert: %w", &mysql.MySQLError{Number: 1062}), want: true},
+		{name: "lock wait timeout", err: &mysql.MySQLError{Number: 1205}},
+		{name: "other error", err: ErrChatRoomNotFound},
+		{name: "nil", err: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsInvalidDataError(tt.err); got != tt.want {
+				t.Errorf("IsInvalidDataError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDuplicateEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062}, want: true},
+		{name: "wrapped", err: xerrors.Errorf("insert: %w", &mysql.MySQLError{Number: 1062}), want: true},
+		{name: "data too long", err: &mysql.MySQLError{Number: 1406}},
+		{name: "nil", err: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicateEntry(tt.err); got != tt.want {
+				t.Errorf("isDuplicateEntry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
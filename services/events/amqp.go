@@ -0,0 +1,130 @@
+package servicesEvents
+
+import (
+	"context"
+	"encoding/json"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"io"
+	"sync"
+	"time"
+)
+
+const publishTimeout = 5 * time.Second
+
+// amqpChannel is the part of *amqp.Channel the publisher needs.
+type amqpChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	IsClosed() bool
+}
+
+// amqpDialer opens a channel on a new connection; closing the returned
+// io.Closer closes both.
+type amqpDialer func(url string) (amqpChannel, io.Closer, error)
+
+func dialAMQP(url string) (amqpChannel, io.Closer, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return channel, conn, nil
+}
+
+// AMQPPublisher publishes every event to each configured queue through the
+// default exchange. A broken connection is re-established on the next
+// publish.
+type AMQPPublisher struct {
+	url    string
+	queues []string
+	dial   amqpDialer
+
+	mu      sync.Mutex
+	conn    io.Closer
+	channel amqpChannel
+}
+
+func NewAMQPPublisher(url string, queues []string) (*AMQPPublisher, error) {
+	return newAMQPPublisher(url, queues, dialAMQP)
+}
+
+func newAMQPPublisher(url string, queues []string, dial amqpDialer) (*AMQPPublisher, error) {
+	p := &AMQPPublisher{
+		url:    url,
+		queues: queues,
+		dial:   dial,
+	}
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *AMQPPublisher) connect() error {
+	channel, conn, err := p.dial(p.url)
+	if err != nil {
+		return err
+	}
+	for _, queue := range p.queues {
+		_, err := channel.QueueDeclare(queue, true, false, false, false, nil)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	p.conn = conn
+	p.channel = channel
+	return nil
+}
+
+func (p *AMQPPublisher) Publish(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel == nil || p.channel.IsClosed() {
+		if p.conn != nil {
+			p.conn.Close()
+			p.conn = nil
+			p.channel = nil
+		}
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	for _, queue := range p.queues {
+		err := p.channel.PublishWithContext(ctx, "", queue, false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    event.EventID,
+			Type:         event.Type,
+			Timestamp:    time.Now(),
+			Body:         body,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *AMQPPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
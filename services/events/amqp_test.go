@@ -0,0 +1,218 @@
+package servicesEvents
+
+import (
+	"context"
+	"data-platform-conversation-kube/config"
+	"encoding/json"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeBroker stands in for RabbitMQ. Every dial opens a new channel; queues
+// and published messages are shared between them like on a real broker.
+type fakeBroker struct {
+	mu        sync.Mutex
+	dials     int
+	dialErr   error
+	declared  map[string]int
+	published map[string][]amqp.Publishing
+	channels  []*fakeChannel
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		declared:  make(map[string]int),
+		published: make(map[string][]amqp.Publishing),
+	}
+}
+
+func (b *fakeBroker) dial(string) (amqpChannel, io.Closer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dials++
+	if b.dialErr != nil {
+		return nil, nil, b.dialErr
+	}
+	channel := &fakeChannel{broker: b}
+	b.channels = append(b.channels, channel)
+	return channel, channel, nil
+}
+
+func (b *fakeBroker) setDialErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dialErr = err
+}
+
+// dropConnection closes the latest channel as if the broker went away.
+func (b *fakeBroker) dropConnection() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.channels[len(b.channels)-1].closed = true
+}
+
+func (b *fakeBroker) messages(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]amqp.Publishing(nil), b.published[queue]...)
+}
+
+type fakeChannel struct {
+	broker *fakeBroker
+	closed bool
+}
+
+func (c *fakeChannel) QueueDeclare(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.declared[name]++
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) PublishWithContext(_ context.Context, exchange, key string, _, _ bool, msg amqp.Publishing) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := c.broker.declared[key]; !ok || exchange != "" {
+		return errors.New("queue not declared")
+	}
+	c.broker.published[key] = append(c.broker.published[key], msg)
+	return nil
+}
+
+func (c *fakeChannel) IsClosed() bool {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeChannel) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestAMQPPublisherPublishesToEveryQueue(t *testing.T) {
+	broker := newFakeBroker()
+	publisher, err := newAMQPPublisher("amqp://fake", []string{"events-a", "events-b"}, broker.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	event := NewEvent(MessageSent, "room-1", MessageSentPayload{MessageID: "m1", Sender: 1001})
+	if err := publisher.Publish(event); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, queue := range []string{"events-a", "events-b"} {
+		messages := broker.messages(queue)
+		if len(messages) != 1 {
+			t.Fatalf("%s received %d messages, want 1", queue, len(messages))
+		}
+		message := messages[0]
+		if message.MessageId != event.EventID || message.Type != MessageSent {
+			t.Errorf("%s message id/type = %s/%s, want %s/%s", queue, message.MessageId, message.Type, event.EventID, MessageSent)
+		}
+		if message.DeliveryMode != amqp.Persistent || message.ContentType != "application/json" {
+			t.Errorf("%s message is not persistent JSON: %+v", queue, message)
+		}
+
+		var received Event
+		if err := json.Unmarshal(message.Body, &received); err != nil {
+			t.Fatal(err)
+		}
+		if received.EventID != event.EventID || received.ChatRoom != "room-1" || received.Version != Version {
+			t.Errorf("%s body = %+v", queue, received)
+		}
+	}
+}
+
+func TestAMQPPublisherReconnects(t *testing.T) {
+	broker := newFakeBroker()
+	publisher, err := newAMQPPublisher("amqp://fake", []string{"events"}, broker.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	if err := publisher.Publish(NewEvent(MessageSent, "room-1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The broker is unreachable: the publish fails but the publisher keeps
+	// trying on later calls.
+	broker.dropConnection()
+	broker.setDialErr(errors.New("connection refused"))
+	if err := publisher.Publish(NewEvent(MessageSent, "room-1", nil)); err == nil {
+		t.Fatal("Publish() succeeded without a connection")
+	}
+
+	broker.setDialErr(nil)
+	if err := publisher.Publish(NewEvent(MessageSent, "room-1", nil)); err != nil {
+		t.Fatalf("Publish() after the broker came back error = %v", err)
+	}
+
+	if got := len(broker.messages("events")); got != 2 {
+		t.Errorf("events received %d messages, want 2", got)
+	}
+	if broker.dials != 3 {
+		t.Errorf("dialled %d times, want 3", broker.dials)
+	}
+	if broker.declared["events"] != 2 {
+		t.Errorf("declared the queue %d times, want once per connection", broker.declared["events"])
+	}
+}
+
+func TestNewAMQPPublisherFailsWithoutBroker(t *testing.T) {
+	broker := newFakeBroker()
+	broker.setDialErr(errors.New("connection refused"))
+
+	if _, err := newAMQPPublisher("amqp://fake", []string{"events"}, broker.dial); err == nil {
+		t.Fatal("newAMQPPublisher() succeeded without a broker")
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		queues  string
+		wantNop bool
+	}{
+		{name: "RabbitMQ not configured", address: "", queues: "events", wantNop: true},
+		{name: "no event queues", address: "127.0.0.1", queues: "", wantNop: true},
+		{name: "blank event queues", address: "127.0.0.1", queues: " , ", wantNop: true},
+		{name: "configured", address: "127.0.0.1", queues: "events"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RMQ_ADDRESS", tt.address)
+			// Nothing listens on port 1, so a real connection attempt fails
+			// right away.
+			t.Setenv("RMQ_PORT", "1")
+			t.Setenv("RMQ_QUEUE_TO_EVENTS", tt.queues)
+
+			publisher, err := NewPublisher(config.NewConf().RMQ)
+			if tt.wantNop {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := publisher.(NopPublisher); !ok {
+					t.Fatalf("NewPublisher() = %T, want NopPublisher", publisher)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("NewPublisher() = %T, want a connection error", publisher)
+			}
+		})
+	}
+}
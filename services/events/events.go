@@ -0,0 +1,107 @@
+package servicesEvents
+
+import (
+	"data-platform-conversation-kube/config"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Version is bumped whenever a payload changes incompatibly, so consumers
+// can tell the shapes apart.
+const Version = 1
+
+const (
+	MessageSent       = "MessageSent"
+	MessageRead       = "MessageRead"
+	RoomCreated       = "RoomCreated"
+	ParticipantLeft   = "ParticipantLeft"
+	AttachmentUpdated = "AttachmentUpdated"
+)
+
+// Event is the JSON document published for other data-platform services.
+type Event struct {
+	EventID    string `json:"eventID"`
+	Type       string `json:"type"`
+	Version    int    `json:"version"`
+	OccurredAt string `json:"occurredAt"`
+	ChatRoom   string `json:"chatRoom"`
+	Payload    any    `json:"payload"`
+}
+
+type MessageSentPayload struct {
+	MessageID   string   `json:"messageID"`
+	Sender      int      `json:"sender"`
+	SenderType  string   `json:"senderType"`
+	Content     string   `json:"content"`
+	SentAt      string   `json:"sentAt"`
+	Sequence    int64    `json:"sequence"`
+	ReplyTo     *string  `json:"replyTo,omitempty"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// MessageReadPayload is published for single read receipts and, with UpTo
+// set, for read-up-to watermarks that cover every earlier message too.
+type MessageReadPayload struct {
+	MessageID    string  `json:"messageID"`
+	Reader       int     `json:"reader"`
+	ReadAt       string  `json:"readAt"`
+	ReadStatusID *string `json:"readStatusID,omitempty"`
+	UpTo         bool    `json:"upTo"`
+}
+
+type RoomCreatedPayload struct {
+	RoomType     string  `json:"roomType"`
+	RoomCreator  int     `json:"roomCreator"`
+	Participants []int   `json:"participants"`
+	Title        *string `json:"title,omitempty"`
+}
+
+type ParticipantLeftPayload struct {
+	BusinessPartner int `json:"businessPartner"`
+}
+
+type AttachmentUpdatedPayload struct {
+	AttachmentID    string  `json:"attachmentID"`
+	MessageID       *string `json:"messageID,omitempty"`
+	PreviewStatus   string  `json:"previewStatus"`
+	Width           *int    `json:"width,omitempty"`
+	Height          *int    `json:"height,omitempty"`
+	PreviewMimeType *string `json:"previewMimeType,omitempty"`
+}
+
+func NewEvent(eventType string, chatRoom string, payload any) Event {
+	return Event{
+		EventID:    uuid.New().String(),
+		Type:       eventType,
+		Version:    Version,
+		OccurredAt: time.Now().Format("2006-01-02 15:04:05.999999"),
+		ChatRoom:   chatRoom,
+		Payload:    payload,
+	}
+}
+
+// Publisher hands conversation events to other services. Publishing is best
+// effort: callers log failures and carry on.
+type Publisher interface {
+	Publish(event Event) error
+	Close() error
+}
+
+func NewPublisher(conf *config.RMQ) (Publisher, error) {
+	if !conf.Enabled() || len(conf.QueueToEvents()) == 0 {
+		return NopPublisher{}, nil
+	}
+	return NewAMQPPublisher(conf.URL(), conf.QueueToEvents())
+}
+
+// NopPublisher drops every event. It is used when RabbitMQ is not
+// configured.
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(Event) error {
+	return nil
+}
+
+func (NopPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,1564 @@
+package services
+
+import (
+	servicesEvents "data-platform-conversation-kube/services/events"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/json"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// inputTimeLayout is the layout timestamps are passed to the store in.
+	inputTimeLayout = "2006-01-02 15:04:05.999999"
+	// millisecondTimeLayout and microsecondTimeLayout match the formats the
+	// MySQL queries read timestamps back in.
+	millisecondTimeLayout = "2006-01-02 15:04:05.000"
+	microsecondTimeLayout = "2006-01-02 15:04:05.000000"
+)
+
+// MemoryStore is a ConversationStore that keeps everything in process. It
+// follows the semantics of MysqlStore, including sequences, idempotent
+// sends, tombstones and the outbox, so controllers can run without MySQL.
+// Profiles and documents are seeded with PutBusinessPartner and
+// PutBusinessPartnerDoc.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	rooms        map[string]*memoryRoom
+	messages     map[string]*memoryMessage
+	roomMessages map[string][]*memoryMessage
+	readStatuses []memoryReadStatus
+	revisions    map[string][]typesMessage.MessageRevision
+	deletions    map[memoryMessageMember]time.Time
+	reactions    []memoryReaction
+	attachments  []*memoryAttachment
+	deliveries   []memoryDelivery
+	watermarks   map[string]map[int]*memoryWatermark
+	lastSeen     map[int]time.Time
+	partners     map[int]typesMessage.BusinessPartnerWithDetails
+	docs         []BusinessPartnerDoc
+	outbox       []*memoryOutboxEvent
+	nextOutboxID int64
+}
+
+type memoryRoom struct {
+	chatRoom     string
+	roomType     string
+	title        *string
+	roomCreator  int
+	roomPartner  *int
+	participants []int
+	createdAt    time.Time
+	lastSequence int64
+}
+
+type memoryMessage struct {
+	messageID       string
+	chatRoom        string
+	businessPartner int
+	senderType      string
+	replyTo         *string
+	content         string
+	sentAt          time.Time
+	editedAt        *time.Time
+	deletedAt       *time.Time
+	deletedBy       *int
+	sequence        int64
+}
+
+type memoryMessageMember struct {
+	messageID       string
+	businessPartner int
+}
+
+type memoryReadStatus struct {
+	readStatusID string
+	messageID    string
+	participant  int
+	readAt       time.Time
+}
+
+type memoryReaction struct {
+	messageID       string
+	businessPartner int
+	emoji           string
+	reactedAt       time.Time
+}
+
+type memoryAttachment struct {
+	attachment typesMessage.Attachment
+	createdAt  time.Time
+	// claimedAt is when a preview worker took the attachment.
+	claimedAt *time.Time
+}
+
+type memoryDelivery struct {
+	messageID   string
+	participant int
+	deliveredAt time.Time
+}
+
+type memoryWatermark struct {
+	messageID string
+	sentAt    time.Time
+	readAt    time.Time
+}
+
+type memoryOutboxEvent struct {
+	outboxID      int64
+	event         servicesEvents.Event
+	occurredAt    time.Time
+	attempts      int
+	nextAttemptAt time.Time
+	lastError     *string
+	publishedAt   *time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rooms:        make(map[string]*memoryRoom),
+		messages:     make(map[string]*memoryMessage),
+		roomMessages: make(map[string][]*memoryMessage),
+		revisions:    make(map[string][]typesMessage.MessageRevision),
+		deletions:    make(map[memoryMessageMember]time.Time),
+		watermarks:   make(map[string]map[int]*memoryWatermark),
+		lastSeen:     make(map[int]time.Time),
+		partners:     make(map[int]typesMessage.BusinessPartnerWithDetails),
+	}
+}
+
+var _ ConversationStore = (*MemoryStore)(nil)
+
+// PutBusinessPartner adds or replaces the profile returned by
+// ReadBusinessPartnerWithDetails.
+func (s *MemoryStore) PutBusinessPartner(partner typesMessage.BusinessPartnerWithDetails) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partners[partner.BusinessPartner] = partner
+}
+
+// PutBusinessPartnerDoc adds a document returned by ReadBusinessPartnerDocs.
+func (s *MemoryStore) PutBusinessPartnerDoc(doc BusinessPartnerDoc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = append(s.docs, doc)
+}
+
+// wallClock drops the location of t the same way formatting it for a
+// DATETIME column does.
+func wallClock(t time.Time) time.Time {
+	return time.Date(
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(),
+		t.Nanosecond()/int(time.Microsecond)*int(time.Microsecond),
+		time.UTC,
+	)
+}
+
+func parseStoreTime(value string) (time.Time, error) {
+	return time.Parse(inputTimeLayout, value)
+}
+
+func formatMilliseconds(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(millisecondTimeLayout)
+	return &formatted
+}
+
+// precedes orders messages by SentAt and MessageID like the MySQL queries.
+func precedes(sentAt time.Time, messageID string, otherSentAt time.Time, otherMessageID string) bool {
+	return sentAt.Before(otherSentAt) || (sentAt.Equal(otherSentAt) && messageID < otherMessageID)
+}
+
+func (r *memoryRoom) members() []int {
+	members := []int{r.roomCreator}
+	if r.roomPartner != nil {
+		members = append(members, *r.roomPartner)
+	}
+	for _, participant := range r.participants {
+		members = append(members, participant)
+	}
+
+	var distinct []int
+	seen := make(map[int]bool)
+	for _, member := range members {
+		if !seen[member] {
+			seen[member] = true
+			distinct = append(distinct, member)
+		}
+	}
+	return distinct
+}
+
+func (r *memoryRoom) hasMember(businessPartner int) bool {
+	for _, member := range r.members() {
+		if member == businessPartner {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) roomMessage(chatRoom string, messageID string) *memoryMessage {
+	message, ok := s.messages[messageID]
+	if !ok || message.chatRoom != chatRoom {
+		return nil
+	}
+	return message
+}
+
+func (s *MemoryStore) deletedForSelf(messageID string, businessPartner int) bool {
+	_, ok := s.deletions[memoryMessageMember{messageID: messageID, businessPartner: businessPartner}]
+	return ok
+}
+
+func (s *MemoryStore) readStatusExists(messageID string, participant int) bool {
+	for _, readStatus := range s.readStatuses {
+		if readStatus.messageID == messageID && readStatus.participant == participant {
+			return true
+		}
+	}
+	return false
+}
+
+// insertOutboxEvent keeps the payload as JSON, as the relay reads it back
+// from the outbox table.
+func (s *MemoryStore) insertOutboxEvent(event servicesEvents.Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	occurredAt, err := parseStoreTime(event.OccurredAt)
+	if err != nil {
+		return err
+	}
+
+	s.nextOutboxID++
+	event.Payload = json.RawMessage(payload)
+	s.outbox = append(s.outbox, &memoryOutboxEvent{
+		outboxID:      s.nextOutboxID,
+		event:         event,
+		occurredAt:    occurredAt,
+		nextAttemptAt: occurredAt,
+	})
+	return nil
+}
+
+func (s *MemoryStore) CreateChatRoom(
+	roomCreator int,
+	roomPartner int,
+) (*string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, room := range s.rooms {
+		if room.roomType != typesMessage.RoomTypeDirect || room.roomPartner == nil {
+			continue
+		}
+		if (room.roomCreator == roomCreator && *room.roomPartner == roomPartner) ||
+			(room.roomCreator == roomPartner && *room.roomPartner == roomCreator) {
+			existingRoomID := room.chatRoom
+			return &existingRoomID, false, nil
+		}
+	}
+
+	chatRoom := uuid.New().String()
+	err := s.insertOutboxEvent(servicesEvents.NewEvent(
+		servicesEvents.RoomCreated,
+		chatRoom,
+		servicesEvents.RoomCreatedPayload{
+			RoomType:     typesMessage.RoomTypeDirect,
+			RoomCreator:  roomCreator,
+			Participants: []int{roomCreator, roomPartner},
+		},
+	))
+	if err != nil {
+		return nil, false, err
+	}
+	s.rooms[chatRoom] = &memoryRoom{
+		chatRoom:    chatRoom,
+		roomType:    typesMessage.RoomTypeDirect,
+		roomCreator: roomCreator,
+		roomPartner: &roomPartner,
+		createdAt:   wallClock(time.Now()),
+	}
+	return &chatRoom, true, nil
+}
+
+func (s *MemoryStore) CreateGroupChatRoom(
+	roomCreator int,
+	participants []int,
+	title string,
+) (*string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chatRoom := uuid.New().String()
+	err := s.insertOutboxEvent(servicesEvents.NewEvent(
+		servicesEvents.RoomCreated,
+		chatRoom,
+		servicesEvents.RoomCreatedPayload{
+			RoomType:     typesMessage.RoomTypeGroup,
+			RoomCreator:  roomCreator,
+			Participants: participants,
+			Title:        &title,
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+	s.rooms[chatRoom] = &memoryRoom{
+		chatRoom:     chatRoom,
+		roomType:     typesMessage.RoomTypeGroup,
+		title:        &title,
+		roomCreator:  roomCreator,
+		participants: append([]int(nil), participants...),
+		createdAt:    wallClock(time.Now()),
+	}
+	return &chatRoom, nil
+}
+
+func (s *MemoryStore) IsChatRoomMember(
+	chatRoom string,
+	businessPartner int,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[chatRoom]
+	return ok && room.hasMember(businessPartner), nil
+}
+
+func (s *MemoryStore) SharesChatRoom(
+	businessPartner int,
+	counterpart int,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, room := range s.rooms {
+		if room.hasMember(businessPartner) && room.hasMember(counterpart) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) CounterpartsSharingChatRoom(
+	businessPartner int,
+	counterparts []int,
+) (map[int]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sharing := make(map[int]bool, len(counterparts))
+	for _, room := range s.rooms {
+		if !room.hasMember(businessPartner) {
+			continue
+		}
+		for _, counterpart := range counterparts {
+			if room.hasMember(counterpart) {
+				sharing[counterpart] = true
+			}
+		}
+	}
+	return sharing, nil
+}
+
+func (s *MemoryStore) ReadChatRooms(
+	businessPartner int,
+	ascending bool,
+	limit int,
+	offset int,
+) (*[]typesMessage.ChatRoomSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type summary struct {
+		chatRoom       typesMessage.ChatRoomSummary
+		lastActivityAt time.Time
+	}
+	var summaries []summary
+	for _, room := range s.rooms {
+		if !room.hasMember(businessPartner) {
+			continue
+		}
+
+		chatRoom := typesMessage.ChatRoomSummary{
+			ChatRoom:  room.chatRoom,
+			RoomType:  room.roomType,
+			Title:     room.title,
+			CreatedAt: room.createdAt.Format(millisecondTimeLayout),
+		}
+		lastActivityAt := room.createdAt
+
+		var lastMessage *memoryMessage
+		watermark := s.watermarks[room.chatRoom][businessPartner]
+		for _, message := range s.roomMessages[room.chatRoom] {
+			if lastMessage == nil || precedes(lastMessage.sentAt, lastMessage.messageID, message.sentAt, message.messageID) {
+				lastMessage = message
+			}
+			if message.businessPartner == businessPartner || s.readStatusExists(message.messageID, businessPartner) {
+				continue
+			}
+			if watermark != nil && !precedes(watermark.sentAt, watermark.messageID, message.sentAt, message.messageID) {
+				continue
+			}
+			chatRoom.UnreadCount++
+		}
+		if lastMessage != nil {
+			content := lastMessage.content
+			if lastMessage.deletedAt != nil {
+				content = ""
+			}
+			chatRoom.LastMessage = &typesMessage.LastMessage{
+				MessageID:       lastMessage.messageID,
+				BusinessPartner: lastMessage.businessPartner,
+				Content:         content,
+				SentAt:          lastMessage.sentAt.Format(millisecondTimeLayout),
+			}
+			lastActivityAt = lastMessage.sentAt
+		}
+		chatRoom.LastActivityAt = lastActivityAt.Format(millisecondTimeLayout)
+
+		summaries = append(summaries, summary{chatRoom: chatRoom, lastActivityAt: lastActivityAt})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		before := precedes(
+			summaries[i].lastActivityAt, summaries[i].chatRoom.ChatRoom,
+			summaries[j].lastActivityAt, summaries[j].chatRoom.ChatRoom,
+		)
+		if ascending {
+			return before
+		}
+		return !before && summaries[i].chatRoom.ChatRoom != summaries[j].chatRoom.ChatRoom
+	})
+
+	var chatRooms []typesMessage.ChatRoomSummary
+	for i := offset; i < len(summaries) && len(chatRooms) < limit; i++ {
+		chatRooms = append(chatRooms, summaries[i].chatRoom)
+	}
+	return &chatRooms, nil
+}
+
+func (s *MemoryStore) ReadChatRoomIDs(
+	businessPartner int,
+) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chatRooms []string
+	for _, room := range s.rooms {
+		if room.hasMember(businessPartner) {
+			chatRooms = append(chatRooms, room.chatRoom)
+		}
+	}
+	sort.Strings(chatRooms)
+	return chatRooms, nil
+}
+
+func (s *MemoryStore) ReadChatRoomsMembers(
+	chatRooms []string,
+) (map[string][]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make(map[string][]int)
+	for _, chatRoom := range chatRooms {
+		if room, ok := s.rooms[chatRoom]; ok {
+			members[chatRoom] = room.members()
+		}
+	}
+	return members, nil
+}
+
+func (s *MemoryStore) ReadConversationHistoryWithReadStatus(
+	chatRoom string,
+	viewer int,
+	before *typesMessage.HistoryCursor,
+	after *typesMessage.HistoryCursor,
+	limit int,
+) (*[]typesMessage.ConversationHistoryWithReadStatus, *typesMessage.HistoryCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cursor *typesMessage.HistoryCursor
+	descending := true
+	if before != nil {
+		cursor = before
+	} else if after != nil {
+		cursor = after
+		descending = false
+	}
+	var cursorSentAt time.Time
+	if cursor != nil {
+		var err error
+		cursorSentAt, err = parseStoreTime(cursor.SentAt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var messages []*memoryMessage
+	for _, message := range s.roomMessages[chatRoom] {
+		if s.deletedForSelf(message.messageID, viewer) {
+			continue
+		}
+		if before != nil && !precedes(message.sentAt, message.messageID, cursorSentAt, cursor.MessageID) {
+			continue
+		}
+		if after != nil && !precedes(cursorSentAt, cursor.MessageID, message.sentAt, message.messageID) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if descending {
+			return precedes(messages[j].sentAt, messages[j].messageID, messages[i].sentAt, messages[i].messageID)
+		}
+		return precedes(messages[i].sentAt, messages[i].messageID, messages[j].sentAt, messages[j].messageID)
+	})
+	// One extra message tells whether another page exists.
+	if len(messages) > limit+1 {
+		messages = messages[:limit+1]
+	}
+
+	var histories []typesMessage.ConversationHistoryWithReadStatus
+	var cursors []typesMessage.HistoryCursor
+	for _, message := range messages {
+		history := typesMessage.ConversationHistoryWithReadStatus{
+			MessageID:       message.messageID,
+			ChatRoom:        message.chatRoom,
+			BusinessPartner: message.businessPartner,
+			SenderType:      message.senderType,
+			ReplyTo:         message.replyTo,
+			Sequence:        message.sequence,
+			Content:         message.content,
+			SentAt:          message.sentAt.Format(millisecondTimeLayout),
+			EditedAt:        formatMilliseconds(message.editedAt),
+			DeletedAt:       formatMilliseconds(message.deletedAt),
+		}
+		if message.deletedAt != nil {
+			history.Content = ""
+		}
+		for participant, watermark := range s.watermarks[chatRoom] {
+			if participant == message.businessPartner {
+				continue
+			}
+			if !precedes(watermark.sentAt, watermark.messageID, message.sentAt, message.messageID) {
+				history.ReadParticipants = append(history.ReadParticipants, participant)
+			}
+		}
+		sort.Ints(history.ReadParticipants)
+
+		cursors = append(cursors, typesMessage.HistoryCursor{
+			SentAt:    message.sentAt.Format(microsecondTimeLayout),
+			MessageID: message.messageID,
+		})
+
+		read := false
+		for _, readStatus := range s.readStatuses {
+			if readStatus.messageID != message.messageID {
+				continue
+			}
+			readStatusID := readStatus.readStatusID
+			readBy := readStatus.participant
+			readAt := readStatus.readAt.Format(millisecondTimeLayout)
+			history.ReadStatusID = &readStatusID
+			history.ReadBy = &readBy
+			history.ReadAt = &readAt
+			histories = append(histories, history)
+			read = true
+		}
+		if !read {
+			histories = append(histories, history)
+		}
+	}
+
+	var nextCursor *typesMessage.HistoryCursor
+	if len(cursors) > limit {
+		overflow := cursors[limit].MessageID
+		for len(histories) > 0 && histories[len(histories)-1].MessageID == overflow {
+			histories = histories[:len(histories)-1]
+		}
+		nextCursor = &cursors[limit-1]
+	}
+
+	if descending {
+		for i, j := 0, len(histories)-1; i < j; i, j = i+1, j-1 {
+			histories[i], histories[j] = histories[j], histories[i]
+		}
+	}
+
+	return &histories, nextCursor, nil
+}
+
+func (s *MemoryStore) InsertConversationHistory(
+	chatRoom string,
+	businessPartner int,
+	senderType string,
+	messageID string,
+	message string,
+	sentAt string,
+	replyTo *string,
+	attachmentIDs []string,
+) (*typesMessage.MessageAccepted, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[chatRoom]
+	if !ok {
+		return nil, false, ErrChatRoomNotFound
+	}
+
+	if stored, ok := s.messages[messageID]; ok {
+		if stored.chatRoom != chatRoom || stored.businessPartner != businessPartner || stored.senderType != senderType {
+			return nil, false, ErrMessageIDConflict
+		}
+		return &typesMessage.MessageAccepted{
+			MessageID: messageID,
+			ChatRoom:  chatRoom,
+			SentAt:    stored.sentAt.Format(inputTimeLayout),
+			Sequence:  stored.sequence,
+		}, true, nil
+	}
+
+	if replyTo != nil && s.roomMessage(chatRoom, *replyTo) == nil {
+		return nil, false, ErrReplyToNotFound
+	}
+
+	parsedSentAt, err := parseStoreTime(sentAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var attachments []*memoryAttachment
+	for _, attachmentID := range attachmentIDs {
+		for _, attachment := range s.attachments {
+			if attachment.attachment.AttachmentID == attachmentID &&
+				attachment.attachment.ChatRoom == chatRoom &&
+				attachment.attachment.Uploader == businessPartner &&
+				attachment.attachment.MessageID == nil {
+				attachments = append(attachments, attachment)
+				break
+			}
+		}
+	}
+	if len(attachments) != len(attachmentIDs) {
+		return nil, false, ErrAttachmentInvalid
+	}
+
+	sequence := room.lastSequence + 1
+	err = s.insertOutboxEvent(servicesEvents.NewEvent(
+		servicesEvents.MessageSent,
+		chatRoom,
+		servicesEvents.MessageSentPayload{
+			MessageID:   messageID,
+			Sender:      businessPartner,
+			SenderType:  senderType,
+			Content:     message,
+			SentAt:      sentAt,
+			Sequence:    sequence,
+			ReplyTo:     replyTo,
+			Attachments: attachmentIDs,
+		},
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	room.lastSequence = sequence
+	stored := &memoryMessage{
+		messageID:       messageID,
+		chatRoom:        chatRoom,
+		businessPartner: businessPartner,
+		senderType:      senderType,
+		replyTo:         replyTo,
+		content:         message,
+		sentAt:          parsedSentAt,
+		sequence:        sequence,
+	}
+	s.messages[messageID] = stored
+	s.roomMessages[chatRoom] = append(s.roomMessages[chatRoom], stored)
+	for _, attachment := range attachments {
+		linkedMessageID := messageID
+		attachment.attachment.MessageID = &linkedMessageID
+	}
+
+	return &typesMessage.MessageAccepted{
+		MessageID: messageID,
+		ChatRoom:  chatRoom,
+		SentAt:    sentAt,
+		Sequence:  sequence,
+	}, false, nil
+}
+
+func (s *MemoryStore) ReadMessagesAfterSequence(
+	chatRoom string,
+	viewer int,
+	afterSequence int64,
+	limit int,
+) (*[]typesMessage.SequencedMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// roomMessages is kept in sequence order.
+	var messages []typesMessage.SequencedMessage
+	for _, message := range s.roomMessages[chatRoom] {
+		if len(messages) >= limit {
+			break
+		}
+		if message.sequence <= afterSequence || s.deletedForSelf(message.messageID, viewer) {
+			continue
+		}
+		content := message.content
+		if message.deletedAt != nil {
+			content = ""
+		}
+		messages = append(messages, typesMessage.SequencedMessage{
+			MessageID:       message.messageID,
+			ChatRoom:        message.chatRoom,
+			BusinessPartner: message.businessPartner,
+			SenderType:      message.senderType,
+			ReplyTo:         message.replyTo,
+			Content:         content,
+			SentAt:          message.sentAt.Format(millisecondTimeLayout),
+			EditedAt:        formatMilliseconds(message.editedAt),
+			DeletedAt:       formatMilliseconds(message.deletedAt),
+			Sequence:        message.sequence,
+		})
+	}
+	return &messages, nil
+}
+
+func (s *MemoryStore) EditMessage(
+	chatRoom string,
+	messageID string,
+	editor int,
+	content string,
+	editedAt time.Time,
+	editWindow time.Duration,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.roomMessage(chatRoom, messageID)
+	if message == nil || message.deletedAt != nil {
+		return ErrMessageNotFound
+	}
+	if message.businessPartner != editor {
+		return ErrNotMessageSender
+	}
+	if message.sentAt.Before(wallClock(editedAt.Add(-editWindow))) {
+		return ErrEditWindowExpired
+	}
+
+	edited := wallClock(editedAt)
+	s.revisions[messageID] = append(s.revisions[messageID], typesMessage.MessageRevision{
+		RevisionID: uuid.New().String(),
+		MessageID:  messageID,
+		Content:    message.content,
+		EditedAt:   edited.Format(millisecondTimeLayout),
+	})
+	message.content = content
+	message.editedAt = &edited
+	return nil
+}
+
+func (s *MemoryStore) DeleteMessageForEveryone(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	deletedAt string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.roomMessage(chatRoom, messageID)
+	if message == nil || message.deletedAt != nil {
+		return ErrMessageNotFound
+	}
+	if message.businessPartner != businessPartner {
+		return ErrNotMessageSender
+	}
+
+	parsedDeletedAt, err := parseStoreTime(deletedAt)
+	if err != nil {
+		return err
+	}
+	deletedBy := businessPartner
+	message.deletedAt = &parsedDeletedAt
+	message.deletedBy = &deletedBy
+	return nil
+}
+
+func (s *MemoryStore) DeleteMessageForSelf(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	deletedAt string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.roomMessage(chatRoom, messageID) == nil {
+		return ErrMessageNotFound
+	}
+
+	parsedDeletedAt, err := parseStoreTime(deletedAt)
+	if err != nil {
+		return err
+	}
+	key := memoryMessageMember{messageID: messageID, businessPartner: businessPartner}
+	if _, ok := s.deletions[key]; !ok {
+		s.deletions[key] = parsedDeletedAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReadMessageRevisions(
+	messageIDs []string,
+) (map[string][]typesMessage.MessageRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := make(map[string][]typesMessage.MessageRevision)
+	for _, messageID := range messageIDs {
+		if stored, ok := s.revisions[messageID]; ok {
+			revisions[messageID] = append([]typesMessage.MessageRevision(nil), stored...)
+		}
+	}
+	return revisions, nil
+}
+
+func (s *MemoryStore) AddReaction(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	emoji string,
+	reactedAt string,
+) error {
+	if emoji == "" || len(emoji) > maxEmojiLength {
+		return ErrInvalidEmoji
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.roomMessage(chatRoom, messageID)
+	if message == nil || message.deletedAt != nil {
+		return ErrMessageNotFound
+	}
+
+	parsedReactedAt, err := parseStoreTime(reactedAt)
+	if err != nil {
+		return err
+	}
+	for _, reaction := range s.reactions {
+		if reaction.messageID == messageID && reaction.businessPartner == businessPartner && reaction.emoji == emoji {
+			return nil
+		}
+	}
+	s.reactions = append(s.reactions, memoryReaction{
+		messageID:       messageID,
+		businessPartner: businessPartner,
+		emoji:           emoji,
+		reactedAt:       parsedReactedAt,
+	})
+	return nil
+}
+
+func (s *MemoryStore) RemoveReaction(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	emoji string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.roomMessage(chatRoom, messageID) == nil {
+		return nil
+	}
+
+	reactions := s.reactions[:0]
+	for _, reaction := range s.reactions {
+		if reaction.messageID == messageID && reaction.businessPartner == businessPartner && reaction.emoji == emoji {
+			continue
+		}
+		reactions = append(reactions, reaction)
+	}
+	s.reactions = reactions
+	return nil
+}
+
+func (s *MemoryStore) ReadMessageReactions(
+	messageIDs []string,
+) (map[string][]typesMessage.ReactionCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, messageID := range messageIDs {
+		wanted[messageID] = true
+	}
+
+	var selected []memoryReaction
+	for _, reaction := range s.reactions {
+		if wanted[reaction.messageID] {
+			selected = append(selected, reaction)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].reactedAt.Before(selected[j].reactedAt)
+	})
+
+	reactions := make(map[string][]typesMessage.ReactionCount)
+	for _, reaction := range selected {
+		counts := reactions[reaction.messageID]
+		found := false
+		for i := range counts {
+			if counts[i].Emoji == reaction.emoji {
+				counts[i].Count++
+				counts[i].BusinessPartners = append(counts[i].BusinessPartners, reaction.businessPartner)
+				found = true
+				break
+			}
+		}
+		if !found {
+			counts = append(counts, typesMessage.ReactionCount{
+				Emoji:            reaction.emoji,
+				Count:            1,
+				BusinessPartners: []int{reaction.businessPartner},
+			})
+		}
+		reactions[reaction.messageID] = counts
+	}
+	return reactions, nil
+}
+
+func (s *MemoryStore) InsertAttachment(
+	attachment typesMessage.Attachment,
+) error {
+	createdAt, err := parseStoreTime(attachment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attachments = append(s.attachments, &memoryAttachment{
+		attachment: typesMessage.Attachment{
+			AttachmentID: attachment.AttachmentID,
+			ChatRoom:     attachment.ChatRoom,
+			Uploader:     attachment.Uploader,
+			FileName:     attachment.FileName,
+			MimeType:     attachment.MimeType,
+			Size:         attachment.Size,
+			StorageKey:   attachment.StorageKey,
+		},
+		createdAt: createdAt,
+	})
+	return nil
+}
+
+// read returns the attachment as scanAttachment builds it from a row.
+func (a *memoryAttachment) read() typesMessage.Attachment {
+	attachment := a.attachment
+	attachment.CreatedAt = a.createdAt.Format(millisecondTimeLayout)
+	if attachment.Width == nil || attachment.Height == nil {
+		attachment.Width = nil
+		attachment.Height = nil
+	}
+	if attachment.PreviewStorageKey != nil {
+		previewURL := AttachmentURL(attachment.ChatRoom, attachment.AttachmentID) + "/preview"
+		attachment.PreviewURL = &previewURL
+	}
+	attachment.URL = AttachmentURL(attachment.ChatRoom, attachment.AttachmentID)
+	return attachment
+}
+
+func (s *MemoryStore) sortedAttachments(include func(attachment *memoryAttachment) bool) []typesMessage.Attachment {
+	var selected []*memoryAttachment
+	for _, attachment := range s.attachments {
+		if include(attachment) {
+			selected = append(selected, attachment)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].createdAt.Before(selected[j].createdAt)
+	})
+
+	var attachments []typesMessage.Attachment
+	for _, attachment := range selected {
+		attachments = append(attachments, attachment.read())
+	}
+	return attachments
+}
+
+func (s *MemoryStore) ReadAttachment(
+	chatRoom string,
+	attachmentID string,
+) (*typesMessage.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.attachment.ChatRoom != chatRoom || attachment.attachment.AttachmentID != attachmentID {
+			continue
+		}
+		if messageID := attachment.attachment.MessageID; messageID != nil {
+			if message, ok := s.messages[*messageID]; ok && message.deletedAt != nil {
+				return nil, ErrAttachmentMissing
+			}
+		}
+		read := attachment.read()
+		return &read, nil
+	}
+	return nil, ErrAttachmentMissing
+}
+
+func (s *MemoryStore) ClaimPendingPreviewAttachments(
+	mimeTypes []string,
+	limit int,
+	claimedAt time.Time,
+	staleBefore time.Time,
+) (*[]typesMessage.Attachment, error) {
+	if limit <= 0 {
+		return &[]typesMessage.Attachment{}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachments := s.sortedAttachments(func(attachment *memoryAttachment) bool {
+		if !attachment.claimable(staleBefore) {
+			return false
+		}
+		for _, mimeType := range mimeTypes {
+			if attachment.attachment.MimeType == mimeType {
+				return true
+			}
+		}
+		return false
+	})
+	if len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+
+	claimed := make(map[string]bool, len(attachments))
+	for _, attachment := range attachments {
+		claimed[attachment.AttachmentID] = true
+	}
+	for _, attachment := range s.attachments {
+		if claimed[attachment.attachment.AttachmentID] {
+			at := claimedAt
+			attachment.claimedAt = &at
+		}
+	}
+	return &attachments, nil
+}
+
+func (s *MemoryStore) ClaimAttachmentPreview(
+	attachmentID string,
+	claimedAt time.Time,
+	staleBefore time.Time,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.attachment.AttachmentID != attachmentID || !attachment.claimable(staleBefore) {
+			continue
+		}
+		attachment.claimedAt = &claimedAt
+		return true, nil
+	}
+	return false, nil
+}
+
+// claimable reports whether the attachment still waits for a preview and
+// nobody has claimed it since staleBefore.
+func (a *memoryAttachment) claimable(staleBefore time.Time) bool {
+	return a.attachment.PreviewStatus == nil &&
+		(a.claimedAt == nil || a.claimedAt.Before(staleBefore))
+}
+
+func (s *MemoryStore) UpdateAttachmentPreview(
+	attachmentID string,
+	previewStatus string,
+	width *int,
+	height *int,
+	previewStorageKey *string,
+	previewMimeType *string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.attachment.AttachmentID != attachmentID {
+			continue
+		}
+		attachment.attachment.PreviewStatus = &previewStatus
+		attachment.attachment.Width = width
+		attachment.attachment.Height = height
+		attachment.attachment.PreviewStorageKey = previewStorageKey
+		attachment.attachment.PreviewMimeType = previewMimeType
+
+		return s.insertOutboxEvent(servicesEvents.NewEvent(
+			servicesEvents.AttachmentUpdated,
+			attachment.attachment.ChatRoom,
+			servicesEvents.AttachmentUpdatedPayload{
+				AttachmentID:    attachmentID,
+				MessageID:       attachment.attachment.MessageID,
+				PreviewStatus:   previewStatus,
+				Width:           width,
+				Height:          height,
+				PreviewMimeType: previewMimeType,
+			},
+		))
+	}
+	return ErrAttachmentMissing
+}
+
+func (s *MemoryStore) ReadUnlinkedAttachments(
+	createdBefore time.Time,
+	limit int,
+) (*[]typesMessage.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachments := s.sortedAttachments(func(attachment *memoryAttachment) bool {
+		return attachment.attachment.MessageID == nil && attachment.createdAt.Before(wallClock(createdBefore))
+	})
+	if len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+	return &attachments, nil
+}
+
+func (s *MemoryStore) DeleteUnlinkedAttachment(
+	attachmentID string,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, attachment := range s.attachments {
+		if attachment.attachment.AttachmentID == attachmentID && attachment.attachment.MessageID == nil {
+			s.attachments = append(s.attachments[:i], s.attachments[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) ReadMessageAttachments(
+	messageIDs []string,
+) (map[string][]typesMessage.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, messageID := range messageIDs {
+		wanted[messageID] = true
+	}
+
+	attachments := make(map[string][]typesMessage.Attachment)
+	linked := s.sortedAttachments(func(attachment *memoryAttachment) bool {
+		return attachment.attachment.MessageID != nil && wanted[*attachment.attachment.MessageID]
+	})
+	for _, attachment := range linked {
+		attachments[*attachment.MessageID] = append(attachments[*attachment.MessageID], attachment)
+	}
+	return attachments, nil
+}
+
+func (s *MemoryStore) insertMessageDelivery(
+	messageID string,
+	participant int,
+	deliveredAt time.Time,
+) bool {
+	for _, delivery := range s.deliveries {
+		if delivery.messageID == messageID && delivery.participant == participant {
+			return false
+		}
+	}
+	s.deliveries = append(s.deliveries, memoryDelivery{
+		messageID:   messageID,
+		participant: participant,
+		deliveredAt: deliveredAt,
+	})
+	return true
+}
+
+func (s *MemoryStore) InsertMessageDelivery(
+	messageID string,
+	participant int,
+	deliveredAt string,
+) (bool, error) {
+	parsedDeliveredAt, err := parseStoreTime(deliveredAt)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertMessageDelivery(messageID, participant, parsedDeliveredAt), nil
+}
+
+func (s *MemoryStore) MarkChatRoomDelivered(
+	chatRoom string,
+	participant int,
+	deliveredAt string,
+) (map[int]int64, error) {
+	parsedDeliveredAt, err := parseStoreTime(deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[chatRoom]
+	if !ok {
+		return nil, ErrChatRoomNotFound
+	}
+
+	delivered := make(map[int]int64)
+	for _, message := range s.roomMessages[chatRoom] {
+		if message.sequence > room.lastSequence ||
+			message.businessPartner == participant ||
+			message.senderType == typesMessage.SenderTypeSystem {
+			continue
+		}
+		if s.insertMessageDelivery(message.messageID, participant, parsedDeliveredAt) &&
+			message.sequence > delivered[message.businessPartner] {
+			delivered[message.businessPartner] = message.sequence
+		}
+	}
+	return delivered, nil
+}
+
+func (s *MemoryStore) ReadMessageDeliveries(
+	messageIDs []string,
+) (map[string][]typesMessage.MessageDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, messageID := range messageIDs {
+		wanted[messageID] = true
+	}
+
+	var selected []memoryDelivery
+	for _, delivery := range s.deliveries {
+		if wanted[delivery.messageID] {
+			selected = append(selected, delivery)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].deliveredAt.Before(selected[j].deliveredAt)
+	})
+
+	deliveries := make(map[string][]typesMessage.MessageDelivery)
+	for _, delivery := range selected {
+		deliveries[delivery.messageID] = append(deliveries[delivery.messageID], typesMessage.MessageDelivery{
+			Participant: delivery.participant,
+			DeliveredAt: delivery.deliveredAt.Format(millisecondTimeLayout),
+		})
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) UpdateReadWatermark(
+	chatRoom string,
+	participant int,
+	messageID string,
+	readAt string,
+) (*typesMessage.ReadWatermark, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.roomMessage(chatRoom, messageID)
+	if message == nil {
+		return nil, false, ErrMessageNotFound
+	}
+
+	current := s.watermarks[chatRoom][participant]
+	if current != nil && !precedes(current.sentAt, current.messageID, message.sentAt, messageID) {
+		return nil, false, nil
+	}
+
+	parsedReadAt, err := parseStoreTime(readAt)
+	if err != nil {
+		return nil, false, err
+	}
+	err = s.insertOutboxEvent(servicesEvents.NewEvent(
+		servicesEvents.MessageRead,
+		chatRoom,
+		servicesEvents.MessageReadPayload{
+			MessageID: messageID,
+			Reader:    participant,
+			ReadAt:    readAt,
+			UpTo:      true,
+		},
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if s.watermarks[chatRoom] == nil {
+		s.watermarks[chatRoom] = make(map[int]*memoryWatermark)
+	}
+	s.watermarks[chatRoom][participant] = &memoryWatermark{
+		messageID: messageID,
+		sentAt:    message.sentAt,
+		readAt:    parsedReadAt,
+	}
+
+	return &typesMessage.ReadWatermark{
+		Participant: participant,
+		MessageID:   messageID,
+		SentAt:      message.sentAt.Format(microsecondTimeLayout),
+		ReadAt:      readAt,
+	}, true, nil
+}
+
+func (s *MemoryStore) ReadReadWatermarks(
+	chatRoom string,
+) (*[]typesMessage.ReadWatermark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var watermarks []typesMessage.ReadWatermark
+	for participant, watermark := range s.watermarks[chatRoom] {
+		watermarks = append(watermarks, typesMessage.ReadWatermark{
+			Participant: participant,
+			MessageID:   watermark.messageID,
+			SentAt:      watermark.sentAt.Format(microsecondTimeLayout),
+			ReadAt:      watermark.readAt.Format(millisecondTimeLayout),
+		})
+	}
+	sort.Slice(watermarks, func(i, j int) bool {
+		return watermarks[i].Participant < watermarks[j].Participant
+	})
+	return &watermarks, nil
+}
+
+func (s *MemoryStore) InsertMessageReadStatus(
+	chatRoom string,
+	readStatusID string,
+	messageID string,
+	participant int,
+	readAt string,
+) (int, error) {
+	parsedReadAt, err := parseStoreTime(readAt)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, ok := s.messages[messageID]
+	if !ok || message.chatRoom != chatRoom {
+		return 0, ErrMessageNotFound
+	}
+
+	err = s.insertOutboxEvent(servicesEvents.NewEvent(
+		servicesEvents.MessageRead,
+		message.chatRoom,
+		servicesEvents.MessageReadPayload{
+			MessageID:    messageID,
+			Reader:       participant,
+			ReadAt:       readAt,
+			ReadStatusID: &readStatusID,
+		},
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	s.readStatuses = append(s.readStatuses, memoryReadStatus{
+		readStatusID: readStatusID,
+		messageID:    messageID,
+		participant:  participant,
+		readAt:       parsedReadAt,
+	})
+	return message.businessPartner, nil
+}
+
+func (s *MemoryStore) ReadBusinessPartnerDocs(
+	businessPartners []int,
+) (*[]BusinessPartnerDoc, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var docs []BusinessPartnerDoc
+	for _, doc := range s.docs {
+		for _, businessPartner := range businessPartners {
+			if doc.BusinessPartner == businessPartner {
+				docs = append(docs, doc)
+				break
+			}
+		}
+	}
+	return &docs, nil
+}
+
+func (s *MemoryStore) ReadBusinessPartnerWithDetails(
+	businessPartnerID int,
+) (*[]typesMessage.BusinessPartnerWithDetails, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var partners []typesMessage.BusinessPartnerWithDetails
+	if partner, ok := s.partners[businessPartnerID]; ok {
+		partners = append(partners, partner)
+	}
+	return &partners, nil
+}
+
+func (s *MemoryStore) UpsertLastSeen(
+	businessPartner int,
+	lastSeenAt string,
+) error {
+	parsedLastSeenAt, err := parseStoreTime(lastSeenAt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen[businessPartner] = parsedLastSeenAt
+	return nil
+}
+
+func (s *MemoryStore) ReadLastSeen(
+	businessPartners []int,
+) (map[int]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastSeen := make(map[int]string)
+	for _, businessPartner := range businessPartners {
+		if lastSeenAt, ok := s.lastSeen[businessPartner]; ok {
+			lastSeen[businessPartner] = lastSeenAt.Format(millisecondTimeLayout)
+		}
+	}
+	return lastSeen, nil
+}
+
+// ProcessOutboxEvents publishes without holding the lock, so publish may use
+// the store. Two relays on the same MemoryStore can publish an event twice,
+// which the at-least-once contract of the outbox allows.
+func (s *MemoryStore) ProcessOutboxEvents(
+	limit int,
+	publish func(event servicesEvents.Event) error,
+	backoff func(attempts int) time.Duration,
+) (int, error) {
+	s.mu.Lock()
+	now := wallClock(time.Now())
+	var pending []*memoryOutboxEvent
+	for _, event := range s.outbox {
+		if len(pending) >= limit {
+			break
+		}
+		if event.publishedAt == nil && !event.nextAttemptAt.After(now) {
+			pending = append(pending, event)
+		}
+	}
+	events := make([]servicesEvents.Event, len(pending))
+	for i, event := range pending {
+		events[i] = event.event
+		events[i].OccurredAt = event.occurredAt.Format(microsecondTimeLayout)
+	}
+	s.mu.Unlock()
+
+	published := 0
+	for i, event := range events {
+		publishErr := publish(event)
+
+		s.mu.Lock()
+		stored := pending[i]
+		stored.attempts++
+		if publishErr == nil {
+			publishedAt := wallClock(time.Now())
+			stored.publishedAt = &publishedAt
+			stored.lastError = nil
+			published++
+		} else {
+			lastError := publishErr.Error()
+			stored.nextAttemptAt = wallClock(time.Now().Add(backoff(stored.attempts)))
+			stored.lastError = &lastError
+		}
+		s.mu.Unlock()
+	}
+	return published, nil
+}
+
+func (s *MemoryStore) DeletePublishedOutboxEvents(
+	before time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	threshold := wallClock(before)
+	outbox := s.outbox[:0]
+	for _, event := range s.outbox {
+		if event.publishedAt != nil && event.publishedAt.Before(threshold) {
+			continue
+		}
+		outbox = append(outbox, event)
+	}
+	s.outbox = outbox
+	return nil
+}
+
+func (s *MemoryStore) ReadOutboxBacklog(
+	limit int,
+) (*typesMessage.OutboxBacklog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := typesMessage.OutboxBacklog{
+		Events: []typesMessage.OutboxEvent{},
+	}
+	var oldestPendingAt *time.Time
+	for _, event := range s.outbox {
+		if event.publishedAt != nil {
+			continue
+		}
+		backlog.Pending++
+		if event.attempts > 0 {
+			backlog.Retrying++
+		}
+		if oldestPendingAt == nil || event.occurredAt.Before(*oldestPendingAt) {
+			occurredAt := event.occurredAt
+			oldestPendingAt = &occurredAt
+		}
+		if len(backlog.Events) < limit {
+			backlog.Events = append(backlog.Events, typesMessage.OutboxEvent{
+				OutboxID:      event.outboxID,
+				EventID:       event.event.EventID,
+				EventType:     event.event.Type,
+				ChatRoom:      event.event.ChatRoom,
+				OccurredAt:    event.occurredAt.Format(millisecondTimeLayout),
+				Attempts:      event.attempts,
+				NextAttemptAt: event.nextAttemptAt.Format(millisecondTimeLayout),
+				LastError:     event.lastError,
+			})
+		}
+	}
+	backlog.OldestPendingAt = formatMilliseconds(oldestPendingAt)
+	return &backlog, nil
+}
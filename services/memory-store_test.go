@@ -0,0 +1,49 @@
+package services
+
+import (
+	typesMessage "data-platform-conversation-kube/types/message"
+	"errors"
+	"testing"
+)
+
+// A MessageID identifies one message across every room: a retry from its
+// sender in its room is a duplicate and any other reuse a conflict. The
+// MySQL store enforces the same through the table's primary key.
+func TestInsertConversationHistoryMessageIDReuse(t *testing.T) {
+	store := NewMemoryStore()
+	direct, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := store.CreateChatRoom(1001, 1003)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(chatRoom string, sender int) (bool, error) {
+		_, duplicate, err := store.InsertConversationHistory(
+			chatRoom,
+			sender,
+			typesMessage.SenderTypeBusinessPartner,
+			"m1",
+			"hello",
+			"2024-04-01 09:00:00",
+			nil,
+			nil,
+		)
+		return duplicate, err
+	}
+
+	if duplicate, err := insert(*direct, 1001); err != nil || duplicate {
+		t.Fatalf("first insert = %v, %v", duplicate, err)
+	}
+	if duplicate, err := insert(*direct, 1001); err != nil || !duplicate {
+		t.Errorf("retry = %v, %v, want a duplicate", duplicate, err)
+	}
+	if _, err := insert(*direct, 1002); !errors.Is(err, ErrMessageIDConflict) {
+		t.Errorf("reuse by another sender error = %v, want ErrMessageIDConflict", err)
+	}
+	if _, err := insert(*other, 1001); !errors.Is(err, ErrMessageIDConflict) {
+		t.Errorf("reuse in another room error = %v, want ErrMessageIDConflict", err)
+	}
+}
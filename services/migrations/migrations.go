@@ -0,0 +1,322 @@
+package servicesMigrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	database "github.com/latonaio/golang-mysql-network-connector"
+	"golang.org/x/xerrors"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in sql/ as <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Versions are applied in ascending order and
+// must never be edited once released; change the schema with a new version.
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	schemaVersionTable = "data_platform_chat_schema_version_data"
+	// lockName serialises migrations started from several pods at once.
+	lockName    = "data_platform_chat_schema_migration"
+	lockTimeout = 60
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *string
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+// load reads the migrations from the sql directory of fsys.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, xerrors.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, xerrors.Errorf("migration %d has files named %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, xerrors.Errorf("migration %d %s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// statements splits a migration into the statements it is made of, since
+// the connection does not allow several statements per query. Statements
+// end with a semicolon at the end of a line; lines starting with -- are
+// comments.
+func statements(migration string) []string {
+	var statements []string
+	var statement strings.Builder
+	for _, line := range strings.Split(migration, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(statement.String()), ";"))
+			statement.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Migrator applies the embedded migrations and records each applied version
+// in the schema version table. MySQL commits DDL implicitly, so a migration
+// that fails half way is not rolled back and has to be repaired by hand
+// before it is run again.
+type Migrator struct {
+	db         *database.Mysql
+	migrations []Migration
+}
+
+func NewMigrator(db *database.Mysql) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// withLock runs f on a single connection holding the migration lock.
+func (m *Migrator) withLock(f func(conn *sql.Conn) error) (err error) {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return xerrors.Errorf("another migration holds lock %s", lockName)
+	}
+	defer func() {
+		_, releaseErr := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+		if err == nil {
+			err = releaseErr
+		}
+	}()
+
+	createQuery := `
+        CREATE TABLE IF NOT EXISTS ` + schemaVersionTable + ` (
+            Version   INT          NOT NULL,
+            Name      VARCHAR(255) NOT NULL,
+            AppliedAt DATETIME(6)  NOT NULL,
+            PRIMARY KEY (Version)
+        ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4
+    `
+	_, err = conn.ExecContext(ctx, createQuery)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func readAppliedVersions(conn *sql.Conn) (map[int]string, error) {
+	query := `
+        SELECT
+            Version,
+            CONCAT(DATE_FORMAT(AppliedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(AppliedAt) / 1000), 3, '0')) AS AppliedAt
+        FROM ` + schemaVersionTable + `
+    `
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func run(conn *sql.Conn, migration Migration, content string) error {
+	for _, statement := range statements(content) {
+		if _, err := conn.ExecContext(context.Background(), statement); err != nil {
+			return xerrors.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Up applies every migration that has not been applied yet and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		appliedVersions, err := readAppliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := appliedVersions[migration.Version]; ok {
+				continue
+			}
+			if err := run(conn, migration, migration.Up); err != nil {
+				return err
+			}
+
+			insertQuery := `
+                INSERT INTO ` + schemaVersionTable + ` (
+                    Version,
+                    Name,
+                    AppliedAt
+                ) VALUES (?, ?, ?)
+            `
+			_, err = conn.ExecContext(
+				context.Background(),
+				insertQuery,
+				migration.Version,
+				migration.Name,
+				time.Now().Format("2006-01-02 15:04:05.999999"),
+			)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		appliedVersions, err := readAppliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := appliedVersions[migration.Version]; !ok {
+				continue
+			}
+			if err := run(conn, migration, migration.Down); err != nil {
+				return err
+			}
+
+			deleteQuery := `
+                DELETE FROM ` + schemaVersionTable + `
+                WHERE Version = ?
+            `
+			_, err = conn.ExecContext(context.Background(), deleteQuery, migration.Version)
+			if err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every embedded migration with the time it was applied, or
+// nil when it is pending.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn) error {
+		appliedVersions, err := readAppliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+			if appliedAt, ok := appliedVersions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,192 @@
+package servicesMigrations
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		migration string
+		want      []string
+	}{
+		{
+			name:      "empty",
+			migration: "",
+			want:      nil,
+		},
+		{
+			name:      "single statement",
+			migration: "DROP TABLE a;\n",
+			want:      []string{"DROP TABLE a"},
+		},
+		{
+			name: "multi-line statements",
+			migration: "CREATE TABLE a (\n" +
+				"    ID INT NOT NULL\n" +
+				");\n" +
+				"\n" +
+				"ALTER TABLE a\n" +
+				"    ADD COLUMN Name VARCHAR(64);\n",
+			want: []string{
+				"CREATE TABLE a (\n    ID INT NOT NULL\n)",
+				"ALTER TABLE a\n    ADD COLUMN Name VARCHAR(64)",
+			},
+		},
+		{
+			name: "comments are skipped",
+			migration: "-- create the table\n" +
+				"CREATE TABLE a (\n" +
+				"    -- the key\n" +
+				"    ID INT NOT NULL\n" +
+				");\n" +
+				"  -- trailing comment;\n",
+			want: []string{"CREATE TABLE a (\n    ID INT NOT NULL\n)"},
+		},
+		{
+			name:      "semicolon inside a line does not split",
+			migration: "UPDATE a SET Name = 'x;y'\nWHERE ID = 1;\n",
+			want:      []string{"UPDATE a SET Name = 'x;y'\nWHERE ID = 1"},
+		},
+		{
+			name:      "missing final semicolon",
+			migration: "DROP TABLE a;\nDROP TABLE b\n",
+			want:      []string{"DROP TABLE a", "DROP TABLE b"},
+		},
+		{
+			name:      "windows line endings",
+			migration: "DROP TABLE a;\r\nDROP TABLE b;\r\n",
+			want:      []string{"DROP TABLE a", "DROP TABLE b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := statements(tt.migration)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"sql/0010_add_b.up.sql":      file("up b"),
+				"sql/0010_add_b.down.sql":    file("down b"),
+				"sql/0002_create_a.up.sql":   file("up a"),
+				"sql/0002_create_a.down.sql": file("down a"),
+			},
+			want: []Migration{
+				{Version: 2, Name: "create_a", Up: "up a", Down: "down a"},
+				{Version: 10, Name: "add_b", Up: "up b", Down: "down b"},
+			},
+		},
+		{
+			name: "unexpected file name",
+			files: fstest.MapFS{
+				"sql/0001_create_a.up.sql":   file("up"),
+				"sql/0001_create_a.down.sql": file("down"),
+				"sql/README.sql":             file(""),
+			},
+			wantErr: true,
+		},
+		{
+			name: "upper case name",
+			files: fstest.MapFS{
+				"sql/0001_Create_A.up.sql":   file("up"),
+				"sql/0001_Create_A.down.sql": file("down"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"sql/0001_create_a.up.sql": file("up"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing up file",
+			files: fstest.MapFS{
+				"sql/0001_create_a.down.sql": file("down"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty up file",
+			files: fstest.MapFS{
+				"sql/0001_create_a.up.sql":   file(""),
+				"sql/0001_create_a.down.sql": file("down"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "names differ between up and down",
+			files: fstest.MapFS{
+				"sql/0001_create_a.up.sql":   file("up"),
+				"sql/0001_create_b.down.sql": file("down"),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing directory",
+			files:   fstest.MapFS{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := load(tt.files)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("load() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadEmbedded guards the shipped migrations: every version has both
+// files, versions are contiguous from 1 and each file splits into at least
+// one statement.
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if len(statements(migration.Up)) == 0 {
+			t.Errorf("migration %d %s has no up statements", migration.Version, migration.Name)
+		}
+		if len(statements(migration.Down)) == 0 {
+			t.Errorf("migration %d %s has no down statements", migration.Version, migration.Name)
+		}
+	}
+}
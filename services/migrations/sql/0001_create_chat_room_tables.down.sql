@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS data_platform_chat_room_message_read_status_data;
+DROP TABLE IF EXISTS data_platform_chat_room_message_data;
+DROP TABLE IF EXISTS data_platform_chat_room_header_data;
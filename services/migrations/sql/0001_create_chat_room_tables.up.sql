@@ -0,0 +1,31 @@
+-- The tables the service started with. They may already exist in databases
+-- set up before migrations were introduced, which this migration adopts.
+CREATE TABLE IF NOT EXISTS data_platform_chat_room_header_data (
+    ChatRoom    VARCHAR(36) NOT NULL,
+    RoomCreator INT         NOT NULL,
+    RoomPartner INT         NOT NULL,
+    CreatedAt   DATETIME(6) NOT NULL,
+    UpdatedAt   DATETIME(6) NOT NULL,
+    PRIMARY KEY (ChatRoom),
+    KEY RoomCreator (RoomCreator),
+    KEY RoomPartner (RoomPartner)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS data_platform_chat_room_message_data (
+    MessageID       VARCHAR(64) NOT NULL,
+    ChatRoom        VARCHAR(36) NOT NULL,
+    BusinessPartner INT         NOT NULL,
+    Content         TEXT        NOT NULL,
+    SentAt          DATETIME(6) NOT NULL,
+    PRIMARY KEY (MessageID),
+    KEY ChatRoomSentAt (ChatRoom, SentAt, MessageID)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS data_platform_chat_room_message_read_status_data (
+    ReadStatusID VARCHAR(36) NOT NULL,
+    MessageID    VARCHAR(64) NOT NULL,
+    Participant  INT         NOT NULL,
+    ReadAt       DATETIME(6) NOT NULL,
+    PRIMARY KEY (ReadStatusID),
+    KEY MessageParticipant (MessageID, Participant)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
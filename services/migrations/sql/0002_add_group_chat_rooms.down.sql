@@ -0,0 +1,10 @@
+DROP TABLE data_platform_chat_room_participant_data;
+
+-- Group rooms cannot be represented without RoomType.
+DELETE FROM data_platform_chat_room_header_data
+WHERE RoomPartner IS NULL;
+
+ALTER TABLE data_platform_chat_room_header_data
+    DROP COLUMN RoomType,
+    DROP COLUMN Title,
+    MODIFY COLUMN RoomPartner INT NOT NULL;
@@ -0,0 +1,14 @@
+-- Group rooms have a title and no RoomPartner; their members are listed in
+-- the participant table.
+ALTER TABLE data_platform_chat_room_header_data
+    ADD COLUMN RoomType VARCHAR(20) NOT NULL DEFAULT 'Direct' AFTER ChatRoom,
+    ADD COLUMN Title VARCHAR(255) NULL AFTER RoomType,
+    MODIFY COLUMN RoomPartner INT NULL;
+
+CREATE TABLE data_platform_chat_room_participant_data (
+    ChatRoom    VARCHAR(36) NOT NULL,
+    Participant INT         NOT NULL,
+    JoinedAt    DATETIME(6) NOT NULL,
+    PRIMARY KEY (ChatRoom, Participant),
+    KEY Participant (Participant)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
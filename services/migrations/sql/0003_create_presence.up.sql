@@ -0,0 +1,5 @@
+CREATE TABLE data_platform_chat_presence_data (
+    BusinessPartner INT         NOT NULL,
+    LastSeenAt      DATETIME(6) NOT NULL,
+    PRIMARY KEY (BusinessPartner)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,4 @@
+DROP TABLE data_platform_chat_room_message_revision_data;
+
+ALTER TABLE data_platform_chat_room_message_data
+    DROP COLUMN EditedAt;
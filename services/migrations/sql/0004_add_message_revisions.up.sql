@@ -0,0 +1,11 @@
+ALTER TABLE data_platform_chat_room_message_data
+    ADD COLUMN EditedAt DATETIME(6) NULL AFTER SentAt;
+
+CREATE TABLE data_platform_chat_room_message_revision_data (
+    RevisionID VARCHAR(36) NOT NULL,
+    MessageID  VARCHAR(64) NOT NULL,
+    Content    TEXT        NOT NULL,
+    EditedAt   DATETIME(6) NOT NULL,
+    PRIMARY KEY (RevisionID),
+    KEY MessageEditedAt (MessageID, EditedAt)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
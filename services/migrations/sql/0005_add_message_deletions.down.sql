@@ -0,0 +1,5 @@
+DROP TABLE data_platform_chat_room_message_deletion_data;
+
+ALTER TABLE data_platform_chat_room_message_data
+    DROP COLUMN DeletedAt,
+    DROP COLUMN DeletedBy;
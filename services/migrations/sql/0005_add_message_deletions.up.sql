@@ -0,0 +1,12 @@
+-- DeletedAt and DeletedBy tombstone messages deleted for everyone; the
+-- deletion table hides messages from a single business partner.
+ALTER TABLE data_platform_chat_room_message_data
+    ADD COLUMN DeletedAt DATETIME(6) NULL AFTER EditedAt,
+    ADD COLUMN DeletedBy INT NULL AFTER DeletedAt;
+
+CREATE TABLE data_platform_chat_room_message_deletion_data (
+    MessageID       VARCHAR(64) NOT NULL,
+    BusinessPartner INT         NOT NULL,
+    DeletedAt       DATETIME(6) NOT NULL,
+    PRIMARY KEY (MessageID, BusinessPartner)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,2 @@
+ALTER TABLE data_platform_chat_room_message_data
+    DROP COLUMN ReplyTo;
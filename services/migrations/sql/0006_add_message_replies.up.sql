@@ -0,0 +1,2 @@
+ALTER TABLE data_platform_chat_room_message_data
+    ADD COLUMN ReplyTo VARCHAR(64) NULL AFTER BusinessPartner;
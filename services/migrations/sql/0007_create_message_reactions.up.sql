@@ -0,0 +1,8 @@
+CREATE TABLE data_platform_chat_room_message_reaction_data (
+    MessageID       VARCHAR(64) NOT NULL,
+    BusinessPartner INT         NOT NULL,
+    Emoji           VARCHAR(32) NOT NULL,
+    ReactedAt       DATETIME(6) NOT NULL,
+    PRIMARY KEY (MessageID, BusinessPartner, Emoji),
+    KEY MessageReactedAt (MessageID, ReactedAt)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
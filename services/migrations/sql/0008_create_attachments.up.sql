@@ -0,0 +1,15 @@
+-- MessageID stays NULL until the attachment is sent with a message.
+CREATE TABLE data_platform_chat_room_attachment_data (
+    AttachmentID VARCHAR(36)  NOT NULL,
+    ChatRoom     VARCHAR(36)  NOT NULL,
+    MessageID    VARCHAR(64)  NULL,
+    Uploader     INT          NOT NULL,
+    FileName     VARCHAR(255) NOT NULL,
+    MimeType     VARCHAR(255) NOT NULL,
+    Size         BIGINT       NOT NULL,
+    StorageKey   VARCHAR(512) NOT NULL,
+    CreatedAt    DATETIME(6)  NOT NULL,
+    PRIMARY KEY (AttachmentID),
+    KEY ChatRoom (ChatRoom),
+    KEY MessageID (MessageID)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
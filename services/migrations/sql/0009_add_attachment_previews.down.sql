@@ -0,0 +1,7 @@
+ALTER TABLE data_platform_chat_room_attachment_data
+    DROP KEY PreviewStatusMimeType,
+    DROP COLUMN Width,
+    DROP COLUMN Height,
+    DROP COLUMN PreviewStatus,
+    DROP COLUMN PreviewStorageKey,
+    DROP COLUMN PreviewMimeType;
@@ -0,0 +1,9 @@
+-- PreviewStatus stays NULL until the preview worker has processed the
+-- attachment.
+ALTER TABLE data_platform_chat_room_attachment_data
+    ADD COLUMN Width INT NULL,
+    ADD COLUMN Height INT NULL,
+    ADD COLUMN PreviewStatus VARCHAR(20) NULL,
+    ADD COLUMN PreviewStorageKey VARCHAR(512) NULL,
+    ADD COLUMN PreviewMimeType VARCHAR(255) NULL,
+    ADD KEY PreviewStatusMimeType (PreviewStatus, MimeType);
@@ -0,0 +1,7 @@
+CREATE TABLE data_platform_chat_room_message_delivery_data (
+    MessageID   VARCHAR(64) NOT NULL,
+    Participant INT         NOT NULL,
+    DeliveredAt DATETIME(6) NOT NULL,
+    PRIMARY KEY (MessageID, Participant),
+    KEY Participant (Participant)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
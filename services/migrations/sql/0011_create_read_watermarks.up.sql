@@ -0,0 +1,8 @@
+CREATE TABLE data_platform_chat_room_read_watermark_data (
+    ChatRoom          VARCHAR(36) NOT NULL,
+    Participant       INT         NOT NULL,
+    LastReadSentAt    DATETIME(6) NOT NULL,
+    LastReadMessageID VARCHAR(64) NOT NULL,
+    ReadAt            DATETIME(6) NOT NULL,
+    PRIMARY KEY (ChatRoom, Participant)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
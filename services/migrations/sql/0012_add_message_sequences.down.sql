@@ -0,0 +1,6 @@
+ALTER TABLE data_platform_chat_room_message_data
+    DROP KEY ChatRoomSequence,
+    DROP COLUMN Sequence;
+
+ALTER TABLE data_platform_chat_room_header_data
+    DROP COLUMN LastSequence;
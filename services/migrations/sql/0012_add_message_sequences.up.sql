@@ -0,0 +1,27 @@
+ALTER TABLE data_platform_chat_room_header_data
+    ADD COLUMN LastSequence BIGINT NOT NULL DEFAULT 0 AFTER Title;
+
+ALTER TABLE data_platform_chat_room_message_data
+    ADD COLUMN Sequence BIGINT NULL AFTER ReplyTo;
+
+-- Existing messages are numbered in the order histories list them.
+UPDATE data_platform_chat_room_message_data AS message
+JOIN (
+    SELECT
+        MessageID,
+        ROW_NUMBER() OVER (PARTITION BY ChatRoom ORDER BY SentAt, MessageID) AS Sequence
+    FROM data_platform_chat_room_message_data
+) AS numbered
+ON numbered.MessageID = message.MessageID
+SET message.Sequence = numbered.Sequence;
+
+UPDATE data_platform_chat_room_header_data AS room
+SET room.LastSequence = (
+    SELECT COALESCE(MAX(message.Sequence), 0)
+    FROM data_platform_chat_room_message_data AS message
+    WHERE message.ChatRoom = room.ChatRoom
+);
+
+ALTER TABLE data_platform_chat_room_message_data
+    MODIFY COLUMN Sequence BIGINT NOT NULL,
+    ADD UNIQUE KEY ChatRoomSequence (ChatRoom, Sequence);
@@ -0,0 +1,3 @@
+-- System messages are stored with SenderType System and BusinessPartner 0.
+ALTER TABLE data_platform_chat_room_message_data
+    ADD COLUMN SenderType VARCHAR(20) NOT NULL DEFAULT 'BusinessPartner' AFTER BusinessPartner;
@@ -0,0 +1 @@
+DROP TABLE data_platform_chat_room_outbox_data;
@@ -0,0 +1,16 @@
+CREATE TABLE data_platform_chat_room_outbox_data (
+    OutboxID      BIGINT      NOT NULL AUTO_INCREMENT,
+    EventID       VARCHAR(36) NOT NULL,
+    EventType     VARCHAR(64) NOT NULL,
+    Version       INT         NOT NULL,
+    ChatRoom      VARCHAR(36) NOT NULL,
+    Payload       JSON        NOT NULL,
+    OccurredAt    DATETIME(6) NOT NULL,
+    Attempts      INT         NOT NULL DEFAULT 0,
+    NextAttemptAt DATETIME(6) NOT NULL,
+    LastError     TEXT        NULL,
+    PublishedAt   DATETIME(6) NULL,
+    PRIMARY KEY (OutboxID),
+    UNIQUE KEY EventID (EventID),
+    KEY PublishedAtNextAttemptAt (PublishedAt, NextAttemptAt)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE data_platform_chat_room_header_data
+    DROP KEY DirectRoomPairKey,
+    DROP COLUMN DirectRoomPairKey;
@@ -0,0 +1,36 @@
+-- Concurrent creates for the same pair could each insert a direct room.
+-- Empty duplicates are dropped in favour of the room that has messages, or
+-- else the oldest one; duplicates that both hold messages make the unique
+-- key below fail and have to be merged by hand.
+DELETE room
+FROM data_platform_chat_room_header_data AS room
+JOIN data_platform_chat_room_header_data AS other
+  ON other.RoomType = room.RoomType
+ AND LEAST(other.RoomCreator, other.RoomPartner) = LEAST(room.RoomCreator, room.RoomPartner)
+ AND GREATEST(other.RoomCreator, other.RoomPartner) = GREATEST(room.RoomCreator, room.RoomPartner)
+ AND other.ChatRoom <> room.ChatRoom
+WHERE room.RoomType = 'Direct'
+  AND NOT EXISTS (
+      SELECT 1 FROM data_platform_chat_room_message_data AS message
+      WHERE message.ChatRoom = room.ChatRoom
+  )
+  AND (
+      EXISTS (
+          SELECT 1 FROM data_platform_chat_room_message_data AS message
+          WHERE message.ChatRoom = other.ChatRoom
+      )
+      OR other.CreatedAt < room.CreatedAt
+      OR (other.CreatedAt = room.CreatedAt AND other.ChatRoom < room.ChatRoom)
+  );
+
+-- Direct rooms are unique per unordered pair of business partners; group
+-- rooms leave the key NULL.
+ALTER TABLE data_platform_chat_room_header_data
+    ADD COLUMN DirectRoomPairKey VARCHAR(23) GENERATED ALWAYS AS (
+        CASE WHEN RoomType = 'Direct' THEN CONCAT(
+            LEAST(RoomCreator, RoomPartner),
+            ':',
+            GREATEST(RoomCreator, RoomPartner)
+        ) END
+    ) STORED,
+    ADD UNIQUE KEY DirectRoomPairKey (DirectRoomPairKey);
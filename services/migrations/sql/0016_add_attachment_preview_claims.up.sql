@@ -0,0 +1,4 @@
+-- PreviewClaimedAt is set when a preview worker takes an attachment, so
+-- workers on other pods leave it alone until the claim goes stale.
+ALTER TABLE data_platform_chat_room_attachment_data
+    ADD COLUMN PreviewClaimedAt DATETIME(6) NULL AFTER PreviewMimeType;
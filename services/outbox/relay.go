@@ -0,0 +1,85 @@
+package servicesOutbox
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"time"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 100
+	maxBackoff   = 5 * time.Minute
+	// retention is how long published events stay in the outbox for
+	// inspection before they are deleted.
+	retention       = 24 * time.Hour
+	cleanupInterval = time.Hour
+)
+
+// Relay publishes the events written to the outbox by the message, read
+// status and attachment preview transactions. An event is marked as published only after the sink
+// accepted it, so delivery is at least once; consumers deduplicate on
+// eventID.
+type Relay struct {
+	store        services.ConversationStore
+	sink         servicesEvents.Publisher
+	customLogger *logger.Logger
+}
+
+func NewRelay(
+	store services.ConversationStore,
+	sink servicesEvents.Publisher,
+	l *logger.Logger,
+) *Relay {
+	return &Relay{
+		store:        store,
+		sink:         sink,
+		customLogger: l,
+	}
+}
+
+func (r *Relay) Start() {
+	go r.run()
+}
+
+func (r *Relay) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for range ticker.C {
+		// Keep draining while full batches come back.
+		for {
+			published, err := r.store.ProcessOutboxEvents(batchSize, r.sink.Publish, backoff)
+			if err != nil {
+				r.customLogger.Error("ProcessOutboxEvents error: %v", err)
+				break
+			}
+			if published < batchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= cleanupInterval {
+			lastCleanup = time.Now()
+			err := r.store.DeletePublishedOutboxEvents(lastCleanup.Add(-retention))
+			if err != nil {
+				r.customLogger.Error("DeletePublishedOutboxEvents error: %v", err)
+			}
+		}
+	}
+}
+
+// backoff doubles the delay with every failed attempt, starting at one
+// second.
+func backoff(attempts int) time.Duration {
+	if attempts > 16 {
+		return maxBackoff
+	}
+	delay := time.Second << (attempts - 1)
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,90 @@
+package servicesPresence
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps presence for a single pod. Its connections live and die
+// with the process, so they never need refreshing.
+type MemoryStore struct {
+	mu              sync.Mutex
+	connections     map[int]map[string]struct{}
+	roomConnections map[roomMember]map[string]struct{}
+	lastSeen        map[int]time.Time
+}
+
+type roomMember struct {
+	chatRoom        string
+	businessPartner int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		connections:     make(map[int]map[string]struct{}),
+		roomConnections: make(map[roomMember]map[string]struct{}),
+		lastSeen:        make(map[int]time.Time),
+	}
+}
+
+func (s *MemoryStore) Connect(connection Connection) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connections[connection.BusinessPartner] == nil {
+		s.connections[connection.BusinessPartner] = make(map[string]struct{})
+	}
+	s.connections[connection.BusinessPartner][connection.ID] = struct{}{}
+
+	member := roomMember{connection.ChatRoom, connection.BusinessPartner}
+	if s.roomConnections[member] == nil {
+		s.roomConnections[member] = make(map[string]struct{})
+	}
+	s.roomConnections[member][connection.ID] = struct{}{}
+	return len(s.connections[connection.BusinessPartner]) == 1, nil
+}
+
+func (s *MemoryStore) Disconnect(connection Connection, at time.Time) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member := roomMember{connection.ChatRoom, connection.BusinessPartner}
+	delete(s.roomConnections[member], connection.ID)
+	left := len(s.roomConnections[member]) == 0
+	if left {
+		delete(s.roomConnections, member)
+	}
+
+	delete(s.connections[connection.BusinessPartner], connection.ID)
+	if len(s.connections[connection.BusinessPartner]) > 0 {
+		return false, left, nil
+	}
+	delete(s.connections, connection.BusinessPartner)
+	s.lastSeen[connection.BusinessPartner] = at
+	return true, left, nil
+}
+
+func (s *MemoryStore) Refresh(connections []Connection) error {
+	return nil
+}
+
+func (s *MemoryStore) Connections(businessPartners []int) (map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections := make(map[int]int, len(businessPartners))
+	for _, businessPartner := range businessPartners {
+		connections[businessPartner] = len(s.connections[businessPartner])
+	}
+	return connections, nil
+}
+
+func (s *MemoryStore) LastSeen(businessPartners []int) (map[int]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastSeen := make(map[int]time.Time, len(businessPartners))
+	for _, businessPartner := range businessPartners {
+		if at, ok := s.lastSeen[businessPartner]; ok {
+			lastSeen[businessPartner] = at
+		}
+	}
+	return lastSeen, nil
+}
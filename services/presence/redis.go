@@ -0,0 +1,216 @@
+package servicesPresence
+
+import (
+	"context"
+	"data-platform-conversation-kube/config"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/xerrors"
+	"strconv"
+	"time"
+)
+
+const (
+	connectionsKeyPrefix     = "data-platform-conversation:presence:connection-leases:"
+	roomConnectionsKeyPrefix = "data-platform-conversation:presence:room-connection-leases:"
+	lastSeenKeyPrefix        = "data-platform-conversation:presence:last-seen:"
+)
+
+// The connections of a business partner, overall and per chat room, are
+// sorted sets of connection IDs scored by the time their lease expires.
+// Expired leases are dropped before every change, and each script runs
+// atomically, so concurrent connects and disconnects on different pods agree
+// on who was first and last.
+var (
+	// KEYS[1] connections, KEYS[2] room connections; ARGV: now, expiry,
+	// connection ID, ttl (ms)
+	connectScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[1])
+	redis.call('ZADD', key, ARGV[2], ARGV[3])
+	redis.call('PEXPIRE', key, ARGV[4])
+end
+return redis.call('ZCARD', KEYS[1])
+`)
+
+	// KEYS[1] connections, KEYS[2] room connections, KEYS[3] last seen;
+	// ARGV: now (ms), connection ID, last seen (µs). Returns whether the
+	// business partner went offline and whether they left the room.
+	disconnectScript = redis.NewScript(`
+for i = 1, 2 do
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', ARGV[1])
+	redis.call('ZREM', KEYS[i], ARGV[2])
+end
+local left = 0
+if redis.call('ZCARD', KEYS[2]) == 0 then
+	left = 1
+end
+if redis.call('ZCARD', KEYS[1]) > 0 then
+	return {0, left}
+end
+redis.call('SET', KEYS[3], ARGV[3])
+return {1, left}
+`)
+)
+
+type RedisStore struct {
+	client *redis.Client
+	ctx    context.Context
+	now    func() time.Time
+}
+
+func NewRedisStore(conf *config.REDIS) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.URL(),
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, xerrors.Errorf("redis ping error: %w", err)
+	}
+
+	return &RedisStore{
+		client: client,
+		ctx:    ctx,
+		now:    time.Now,
+	}, nil
+}
+
+func (s *RedisStore) Connect(connection Connection) (bool, error) {
+	now := s.now()
+	connections, err := connectScript.Run(
+		s.ctx,
+		s.client,
+		[]string{
+			connectionsKey(connection.BusinessPartner),
+			roomConnectionsKey(connection.ChatRoom, connection.BusinessPartner),
+		},
+		now.UnixMilli(),
+		now.Add(connectionTTL).UnixMilli(),
+		connection.ID,
+		connectionTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return connections == 1, nil
+}
+
+func (s *RedisStore) Disconnect(connection Connection, at time.Time) (bool, bool, error) {
+	result, err := disconnectScript.Run(
+		s.ctx,
+		s.client,
+		[]string{
+			connectionsKey(connection.BusinessPartner),
+			roomConnectionsKey(connection.ChatRoom, connection.BusinessPartner),
+			lastSeenKey(connection.BusinessPartner),
+		},
+		s.now().UnixMilli(),
+		connection.ID,
+		at.UnixMicro(),
+	).Int64Slice()
+	if err != nil {
+		return false, false, err
+	}
+	return result[0] == 1, result[1] == 1, nil
+}
+
+func (s *RedisStore) Refresh(connections []Connection) error {
+	if len(connections) == 0 {
+		return nil
+	}
+	expiry := float64(s.now().Add(connectionTTL).UnixMilli())
+	_, err := s.client.Pipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		for _, connection := range connections {
+			for _, key := range []string{
+				connectionsKey(connection.BusinessPartner),
+				roomConnectionsKey(connection.ChatRoom, connection.BusinessPartner),
+			} {
+				pipe.ZAdd(s.ctx, key, redis.Z{Score: expiry, Member: connection.ID})
+				pipe.PExpire(s.ctx, key, connectionTTL)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Connections(businessPartners []int) (map[int]int, error) {
+	now := strconv.FormatInt(s.now().UnixMilli(), 10)
+	counts := make([]*redis.IntCmd, len(businessPartners))
+	_, err := s.client.Pipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		for i, businessPartner := range businessPartners {
+			counts[i] = pipe.ZCount(s.ctx, connectionsKey(businessPartner), "("+now, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	connections := make(map[int]int, len(businessPartners))
+	for i, businessPartner := range businessPartners {
+		if count := counts[i].Val(); count > 0 {
+			connections[businessPartner] = int(count)
+		}
+	}
+	return connections, nil
+}
+
+func (s *RedisStore) LastSeen(businessPartners []int) (map[int]time.Time, error) {
+	keys := make([]string, len(businessPartners))
+	for i, businessPartner := range businessPartners {
+		keys[i] = lastSeenKey(businessPartner)
+	}
+
+	values, err := s.mGetInt(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	lastSeen := make(map[int]time.Time, len(businessPartners))
+	for i, businessPartner := range businessPartners {
+		if values[i] != nil {
+			lastSeen[businessPartner] = time.UnixMicro(*values[i])
+		}
+	}
+	return lastSeen, nil
+}
+
+func (s *RedisStore) mGetInt(keys []string) ([]*int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values, err := s.client.MGet(s.ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make([]*int64, len(values))
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid presence value for %s: %w", keys[i], err)
+		}
+		parsed[i] = &v
+	}
+	return parsed, nil
+}
+
+func connectionsKey(businessPartner int) string {
+	return fmt.Sprintf("%s%d", connectionsKeyPrefix, businessPartner)
+}
+
+func roomConnectionsKey(chatRoom string, businessPartner int) string {
+	return fmt.Sprintf("%s%s:%d", roomConnectionsKeyPrefix, chatRoom, businessPartner)
+}
+
+func lastSeenKey(businessPartner int) string {
+	return fmt.Sprintf("%s%d", lastSeenKeyPrefix, businessPartner)
+}
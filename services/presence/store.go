@@ -0,0 +1,43 @@
+package servicesPresence
+
+import (
+	"data-platform-conversation-kube/config"
+	"time"
+)
+
+const (
+	// connectionTTL is how long a connection counts as open without a
+	// heartbeat from the pod holding it, so the connections of a pod that
+	// died without closing them expire on their own.
+	connectionTTL     = 90 * time.Second
+	heartbeatInterval = 30 * time.Second
+)
+
+// Connection is one open websocket of a business partner in a chat room.
+type Connection struct {
+	ID              string
+	ChatRoom        string
+	BusinessPartner int
+}
+
+// Store tracks the open connections of each business partner across every
+// pod and remembers when the last one closed.
+type Store interface {
+	// Connect returns true when this is the first open connection.
+	Connect(connection Connection) (bool, error)
+	// Disconnect reports whether this was the last open connection of the
+	// business partner anywhere and the last one in its chat room.
+	Disconnect(connection Connection, at time.Time) (offline bool, left bool, err error)
+	// Refresh keeps the given connections of this pod open for another
+	// connectionTTL.
+	Refresh(connections []Connection) error
+	Connections(businessPartners []int) (map[int]int, error)
+	LastSeen(businessPartners []int) (map[int]time.Time, error)
+}
+
+func NewStore(conf *config.REDIS) (Store, error) {
+	if !conf.Enabled() {
+		return NewMemoryStore(), nil
+	}
+	return NewRedisStore(conf)
+}
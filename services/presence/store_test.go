@@ -0,0 +1,206 @@
+package servicesPresence
+
+import (
+	"data-platform-conversation-kube/config"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is the time of every RedisStore built by newTestRedisStores.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestRedisStores returns one store per pod, all sharing a fresh
+// in-process Redis and clock.
+func newTestRedisStores(t *testing.T, pods int) ([]*RedisStore, *testClock) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	host, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDIS_HOST", host)
+	t.Setenv("REDIS_PORT", port)
+	t.Setenv("REDIS_PASSWORD", "")
+	t.Setenv("REDIS_DB", "")
+	conf := config.NewConf().REDIS
+
+	clock := &testClock{now: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)}
+	stores := make([]*RedisStore, pods)
+	for i := range stores {
+		store, err := NewRedisStore(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.client.Close() })
+		store.now = clock.Now
+		stores[i] = store
+	}
+	return stores, clock
+}
+
+func connection(id string, businessPartner int) Connection {
+	return Connection{ID: id, ChatRoom: "room-1", BusinessPartner: businessPartner}
+}
+
+func TestStoreCountsConnections(t *testing.T) {
+	redisStores, _ := newTestRedisStores(t, 2)
+	tests := []struct {
+		name string
+		pods []Store
+	}{
+		{name: "memory", pods: []Store{NewMemoryStore()}},
+		{name: "redis across pods", pods: []Store{redisStores[0], redisStores[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podA, podB := tt.pods[0], tt.pods[len(tt.pods)-1]
+
+			if online, err := podA.Connect(connection("phone", 1001)); err != nil || !online {
+				t.Fatalf("first Connect() = %v, %v, want online", online, err)
+			}
+			if online, err := podB.Connect(connection("laptop", 1001)); err != nil || online {
+				t.Fatalf("second Connect() = %v, %v, want already online", online, err)
+			}
+			connections, err := podA.Connections([]int{1001, 1002})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if connections[1001] != 2 || connections[1002] != 0 {
+				t.Errorf("Connections() = %v, want 2 for 1001 and none for 1002", connections)
+			}
+
+			tablet := Connection{ID: "tablet", ChatRoom: "room-2", BusinessPartner: 1001}
+			if _, err := podB.Connect(tablet); err != nil {
+				t.Fatal(err)
+			}
+
+			at := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+			disconnects := []struct {
+				pod         Store
+				connection  Connection
+				wantOffline bool
+				wantLeft    bool
+			}{
+				{pod: podA, connection: connection("phone", 1001)},
+				{pod: podB, connection: tablet, wantLeft: true},
+				{pod: podB, connection: connection("laptop", 1001), wantOffline: true, wantLeft: true},
+			}
+			for _, d := range disconnects {
+				offline, left, err := d.pod.Disconnect(d.connection, at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if offline != d.wantOffline || left != d.wantLeft {
+					t.Errorf("Disconnect(%s) = offline %v, left %v, want %v, %v", d.connection.ID, offline, left, d.wantOffline, d.wantLeft)
+				}
+			}
+
+			lastSeen, err := podB.LastSeen([]int{1001, 1002})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lastSeen) != 1 || !lastSeen[1001].Equal(at) {
+				t.Errorf("LastSeen() = %v, want only 1001 at %v", lastSeen, at)
+			}
+		})
+	}
+}
+
+// A pod that dies keeps no one online: its connections expire unless it
+// refreshes them.
+func TestRedisStoreExpiresConnectionsOfDeadPod(t *testing.T) {
+	stores, clock := newTestRedisStores(t, 2)
+	livePod, deadPod := stores[0], stores[1]
+
+	if _, err := livePod.Connect(connection("live", 1001)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deadPod.Connect(connection("dead", 1002)); err != nil {
+		t.Fatal(err)
+	}
+
+	for elapsed := time.Duration(0); elapsed <= 2*connectionTTL; elapsed += heartbeatInterval {
+		if err := livePod.Refresh([]Connection{connection("live", 1001)}); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(heartbeatInterval)
+	}
+
+	connections, err := livePod.Connections([]int{1001, 1002})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connections[1001] != 1 || connections[1002] != 0 {
+		t.Errorf("Connections() = %v, want 1001 online and 1002 expired", connections)
+	}
+
+	// The expired connection no longer counts when 1002 comes back.
+	if online, err := livePod.Connect(connection("again", 1002)); err != nil || !online {
+		t.Errorf("Connect() after expiry = %v, %v, want online", online, err)
+	}
+}
+
+// Concurrent connects and disconnects on many pods report exactly one
+// online and one offline transition.
+func TestRedisStoreTransitionsAreAtomic(t *testing.T) {
+	stores, _ := newTestRedisStores(t, 4)
+
+	const devices = 20
+	run := func(change func(store *RedisStore, id string) (bool, error)) int {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		transitions := 0
+		for i := 0; i < devices; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				transitioned, err := change(stores[i%len(stores)], fmt.Sprintf("device-%d", i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if transitioned {
+					mu.Lock()
+					transitions++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+		return transitions
+	}
+
+	online := run(func(store *RedisStore, id string) (bool, error) {
+		return store.Connect(connection(id, 1001))
+	})
+	if online != 1 {
+		t.Errorf("%d connects reported online, want 1", online)
+	}
+	offline := run(func(store *RedisStore, id string) (bool, error) {
+		offline, _, err := store.Disconnect(connection(id, 1001), time.Now())
+		return offline, err
+	})
+	if offline != 1 {
+		t.Errorf("%d disconnects reported offline, want 1", offline)
+	}
+}
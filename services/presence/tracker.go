@@ -0,0 +1,187 @@
+package servicesPresence
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"sync"
+	"time"
+)
+
+const PresenceChanged = "PresenceChanged"
+
+// Tracker turns connection counts into online/offline transitions, notifies
+// every room of the business partner about them and persists the last-seen
+// time in the conversation store so it outlives the shared store. It keeps
+// the connections open on this pod alive in the store with a heartbeat.
+type Tracker struct {
+	store         Store
+	conversations services.ConversationStore
+	broadcaster   servicesBroadcast.Broadcaster
+	customLogger  *logger.Logger
+
+	mu          sync.Mutex
+	connections map[string]Connection
+}
+
+func NewTracker(
+	store Store,
+	conversations services.ConversationStore,
+	broadcaster servicesBroadcast.Broadcaster,
+	l *logger.Logger,
+) *Tracker {
+	return &Tracker{
+		store:         store,
+		conversations: conversations,
+		broadcaster:   broadcaster,
+		customLogger:  l,
+		connections:   make(map[string]Connection),
+	}
+}
+
+// Start refreshes the connections open on this pod every heartbeatInterval.
+func (t *Tracker) Start() {
+	go t.run()
+}
+
+func (t *Tracker) run() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := t.refresh(); err != nil {
+			t.customLogger.Error("Failed to refresh presence: %v", err)
+		}
+	}
+}
+
+// refresh holds the lock while it writes so a connection closed meanwhile is
+// removed from the store only after its last refresh.
+func (t *Tracker) refresh() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	connections := make([]Connection, 0, len(t.connections))
+	for _, connection := range t.connections {
+		connections = append(connections, connection)
+	}
+	return t.store.Refresh(connections)
+}
+
+func (t *Tracker) Connect(connection Connection) error {
+	t.mu.Lock()
+	t.connections[connection.ID] = connection
+	t.mu.Unlock()
+
+	online, err := t.store.Connect(connection)
+	if err != nil {
+		return err
+	}
+	if !online {
+		return nil
+	}
+	return t.notify(typesMessage.Presence{
+		BusinessPartner: connection.BusinessPartner,
+		Status:          typesMessage.PresenceOnline,
+	})
+}
+
+// Disconnect returns true when this was the last connection of the business
+// partner to its chat room on any pod.
+func (t *Tracker) Disconnect(connection Connection) (bool, error) {
+	t.mu.Lock()
+	delete(t.connections, connection.ID)
+	t.mu.Unlock()
+
+	now := time.Now()
+	offline, left, err := t.store.Disconnect(connection, now)
+	if err != nil {
+		return false, err
+	}
+	if !offline {
+		return left, nil
+	}
+
+	businessPartner := connection.BusinessPartner
+	err = t.conversations.UpsertLastSeen(
+		businessPartner,
+		now.Format("2006-01-02 15:04:05.999999"),
+	)
+	if err != nil {
+		return left, err
+	}
+
+	lastSeenAt := now.Format("2006-01-02 15:04:05.000")
+	return left, t.notify(typesMessage.Presence{
+		BusinessPartner: businessPartner,
+		Status:          typesMessage.PresenceOffline,
+		LastSeenAt:      &lastSeenAt,
+	})
+}
+
+func (t *Tracker) Read(businessPartners []int) (*[]typesMessage.Presence, error) {
+	connections, err := t.store.Connections(businessPartners)
+	if err != nil {
+		return nil, err
+	}
+	lastSeen, err := t.store.LastSeen(businessPartners)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []int
+	for _, businessPartner := range businessPartners {
+		if _, ok := lastSeen[businessPartner]; !ok {
+			missing = append(missing, businessPartner)
+		}
+	}
+	persistedLastSeen, err := t.conversations.ReadLastSeen(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	presences := make([]typesMessage.Presence, 0, len(businessPartners))
+	for _, businessPartner := range businessPartners {
+		presence := typesMessage.Presence{
+			BusinessPartner: businessPartner,
+			Status:          typesMessage.PresenceOffline,
+		}
+		if connections[businessPartner] > 0 {
+			presence.Status = typesMessage.PresenceOnline
+		}
+		if at, ok := lastSeen[businessPartner]; ok {
+			lastSeenAt := at.Format("2006-01-02 15:04:05.000")
+			presence.LastSeenAt = &lastSeenAt
+		} else if lastSeenAt, ok := persistedLastSeen[businessPartner]; ok {
+			presence.LastSeenAt = &lastSeenAt
+		}
+		presences = append(presences, presence)
+	}
+	return &presences, nil
+}
+
+func (t *Tracker) notify(presence typesMessage.Presence) error {
+	chatRooms, err := t.conversations.ReadChatRoomIDs(presence.BusinessPartner)
+	if err != nil {
+		return err
+	}
+
+	for _, chatRoom := range chatRooms {
+		err := t.broadcaster.Publish(
+			chatRoom,
+			servicesBroadcast.Except(presence.BusinessPartner),
+			map[string]any{
+				"type":            PresenceChanged,
+				"chatRoom":        chatRoom,
+				"businessPartner": presence.BusinessPartner,
+				"status":          presence.Status,
+				"lastSeenAt":      presence.LastSeenAt,
+			},
+		)
+		if err != nil {
+			t.customLogger.Error("Failed to publish presence: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package servicesPresence
+
+import (
+	"data-platform-conversation-kube/services"
+	servicesBroadcast "data-platform-conversation-kube/services/broadcast"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"testing"
+)
+
+// The heartbeat keeps the connections still open on the pod alive and lets
+// the closed ones go.
+func TestTrackerRefreshesOpenConnections(t *testing.T) {
+	stores, clock := newTestRedisStores(t, 1)
+	tracker := NewTracker(
+		stores[0],
+		services.NewMemoryStore(),
+		servicesBroadcast.NewMemoryBroadcaster(),
+		logger.NewLogger(),
+	)
+
+	for _, c := range []Connection{connection("open", 1001), connection("closed", 1002)} {
+		if err := tracker.Connect(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tracker.Disconnect(connection("closed", 1002)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(heartbeatInterval)
+		if err := tracker.refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connections, err := stores[0].Connections([]int{1001, 1002})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connections[1001] != 1 || connections[1002] != 0 {
+		t.Errorf("Connections() = %v, want only 1001 online", connections)
+	}
+}
@@ -0,0 +1,240 @@
+package servicesPreview
+
+import (
+	"bytes"
+	"data-platform-conversation-kube/services"
+	servicesStorage "data-platform-conversation-kube/services/storage"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/xerrors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	queueSize = 256
+	// sweepInterval is how often each pod claims attachments that were left
+	// without a preview, by a full queue or by a pod that died.
+	sweepInterval = time.Minute
+	// claimTTL is how long a claim keeps other workers away from an
+	// attachment.
+	claimTTL = 10 * time.Minute
+	// maxPixels guards against decompression bombs; larger images keep their
+	// dimensions but get no preview.
+	maxPixels = 50_000_000
+)
+
+// PreviewMimeTypes are the uploads the worker can decode.
+var PreviewMimeTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+}
+
+// Worker generates downscaled previews and records the dimensions of image
+// attachments in the background, next to the original in the same storage.
+type Worker struct {
+	store        services.ConversationStore
+	storage      servicesStorage.Storage
+	customLogger *logger.Logger
+	maxDimension int
+	queue        chan job
+}
+
+// job is an attachment waiting in the queue. Attachments found by the sweep
+// are claimed before they are queued; uploads are claimed when they are
+// taken off the queue.
+type job struct {
+	attachment typesMessage.Attachment
+	claimed    bool
+}
+
+func NewWorker(
+	store services.ConversationStore,
+	storage servicesStorage.Storage,
+	l *logger.Logger,
+	maxDimension int,
+) *Worker {
+	return &Worker{
+		store:        store,
+		storage:      storage,
+		customLogger: l,
+		maxDimension: maxDimension,
+		queue:        make(chan job, queueSize),
+	}
+}
+
+// Start runs the given number of workers and periodically claims the
+// attachments left without a preview.
+func (w *Worker) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go w.run()
+	}
+	go w.sweep()
+}
+
+// Enqueue schedules a preview without blocking the upload. When the queue is
+// full the attachment is picked up again by a later sweep.
+func (w *Worker) Enqueue(attachment typesMessage.Attachment) {
+	if !IsPreviewable(attachment.MimeType) {
+		return
+	}
+	select {
+	case w.queue <- job{attachment: attachment}:
+	default:
+		w.customLogger.Warn("Preview queue is full, deferring %s", attachment.AttachmentID)
+	}
+}
+
+func IsPreviewable(mimeType string) bool {
+	for _, v := range PreviewMimeTypes {
+		if v == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Worker) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		// Claim only what fits, so claimed attachments do not go stale in
+		// the queue.
+		free := cap(w.queue) - len(w.queue)
+		if free == 0 {
+			continue
+		}
+		now := time.Now()
+		pending, err := w.store.ClaimPendingPreviewAttachments(PreviewMimeTypes, free, now, now.Add(-claimTTL))
+		if err != nil {
+			w.customLogger.Error("ClaimPendingPreviewAttachments error: %v", err)
+			continue
+		}
+		for _, attachment := range *pending {
+			w.queue <- job{attachment: attachment, claimed: true}
+		}
+	}
+}
+
+func (w *Worker) run() {
+	for job := range w.queue {
+		w.process(job)
+	}
+}
+
+// process generates the preview of a queued attachment unless a worker on
+// another pod has claimed it.
+func (w *Worker) process(job job) {
+	attachment := job.attachment
+	if !job.claimed {
+		now := time.Now()
+		claimed, err := w.store.ClaimAttachmentPreview(attachment.AttachmentID, now, now.Add(-claimTTL))
+		if err != nil {
+			w.customLogger.Error("ClaimAttachmentPreview error: %v", err)
+			return
+		}
+		if !claimed {
+			return
+		}
+	}
+
+	if err := w.generate(attachment); err != nil {
+		w.customLogger.Error("Failed to generate preview for %s: %v", attachment.AttachmentID, err)
+		err = w.store.UpdateAttachmentPreview(
+			attachment.AttachmentID,
+			typesMessage.PreviewStatusFailed,
+			nil, nil, nil, nil,
+		)
+		if err != nil {
+			w.customLogger.Error("UpdateAttachmentPreview error: %v", err)
+		}
+	}
+}
+
+func (w *Worker) generate(attachment typesMessage.Attachment) error {
+	body, err := w.storage.Get(attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	original, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return xerrors.Errorf("decode image config error: %w", err)
+	}
+	width, height := config.Width, config.Height
+	if width*height > maxPixels {
+		return w.store.UpdateAttachmentPreview(
+			attachment.AttachmentID,
+			typesMessage.PreviewStatusFailed,
+			&width, &height, nil, nil,
+		)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return xerrors.Errorf("decode image error: %w", err)
+	}
+
+	previewWidth, previewHeight := fit(width, height, w.maxDimension)
+	dst := image.NewRGBA(image.Rect(0, 0, previewWidth, previewHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	// PNG keeps transparency for formats that may carry it; photos are JPEG.
+	var encoded bytes.Buffer
+	previewMimeType := "image/jpeg"
+	if attachment.MimeType == "image/png" || attachment.MimeType == "image/gif" {
+		previewMimeType = "image/png"
+		err = png.Encode(&encoded, dst)
+	} else {
+		err = jpeg.Encode(&encoded, dst, &jpeg.Options{Quality: 80})
+	}
+	if err != nil {
+		return xerrors.Errorf("encode preview error: %w", err)
+	}
+
+	previewStorageKey := attachment.StorageKey + ".preview." + strings.TrimPrefix(previewMimeType, "image/")
+	err = w.storage.Put(
+		previewStorageKey,
+		bytes.NewReader(encoded.Bytes()),
+		int64(encoded.Len()),
+		previewMimeType,
+	)
+	if err != nil {
+		return err
+	}
+
+	return w.store.UpdateAttachmentPreview(
+		attachment.AttachmentID,
+		typesMessage.PreviewStatusReady,
+		&width, &height,
+		&previewStorageKey,
+		&previewMimeType,
+	)
+}
+
+// fit scales width and height down to maxDimension on the longer side,
+// keeping the aspect ratio. Smaller images keep their size.
+func fit(width int, height int, maxDimension int) (int, int) {
+	if width <= maxDimension && height <= maxDimension {
+		return width, height
+	}
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
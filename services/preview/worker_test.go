@@ -0,0 +1,224 @@
+package servicesPreview
+
+import (
+	"bytes"
+	"data-platform-conversation-kube/services"
+	servicesEvents "data-platform-conversation-kube/services/events"
+	servicesStorage "data-platform-conversation-kube/services/storage"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"encoding/binary"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+const testMaxDimension = 20
+
+type testWorker struct {
+	worker   *Worker
+	store    *services.MemoryStore
+	storage  *servicesStorage.FilesystemStorage
+	chatRoom string
+}
+
+func newTestWorker(t *testing.T) *testWorker {
+	t.Helper()
+
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := servicesStorage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testWorker{
+		worker:   NewWorker(store, storage, logger.NewLogger(), testMaxDimension),
+		store:    store,
+		storage:  storage,
+		chatRoom: *chatRoom,
+	}
+}
+
+// upload stores content as an attachment the way the attachments controller
+// does, without enqueueing it.
+func (w *testWorker) upload(t *testing.T, attachmentID string, mimeType string, content []byte) typesMessage.Attachment {
+	t.Helper()
+
+	attachment := typesMessage.Attachment{
+		AttachmentID: attachmentID,
+		ChatRoom:     w.chatRoom,
+		Uploader:     1001,
+		FileName:     attachmentID,
+		MimeType:     mimeType,
+		Size:         int64(len(content)),
+		StorageKey:   w.chatRoom + "/" + attachmentID,
+		CreatedAt:    time.Now().Format("2006-01-02 15:04:05.999999"),
+	}
+	err := w.storage.Put(attachment.StorageKey, bytes.NewReader(content), attachment.Size, mimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.store.InsertAttachment(attachment); err != nil {
+		t.Fatal(err)
+	}
+	return attachment
+}
+
+func (w *testWorker) read(t *testing.T, attachmentID string) *typesMessage.Attachment {
+	t.Helper()
+
+	attachment, err := w.store.ReadAttachment(w.chatRoom, attachmentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attachment
+}
+
+func encodePNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+// encodeOversizedGIF returns a tiny GIF whose header claims more than
+// maxPixels, which is all DecodeConfig reads.
+func encodeOversizedGIF(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := gif.Encode(&encoded, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White}), nil); err != nil {
+		t.Fatal(err)
+	}
+	content := encoded.Bytes()
+	binary.LittleEndian.PutUint16(content[6:8], uint16(width))
+	binary.LittleEndian.PutUint16(content[8:10], uint16(height))
+	return content
+}
+
+func TestProcessStoresPreviewOfImage(t *testing.T) {
+	w := newTestWorker(t)
+	uploaded := w.upload(t, "a1", "image/png", encodePNG(t, 100, 50))
+
+	w.worker.process(job{attachment: uploaded})
+
+	attachment := w.read(t, "a1")
+	if attachment.PreviewStatus == nil || *attachment.PreviewStatus != typesMessage.PreviewStatusReady {
+		t.Fatalf("PreviewStatus = %v, want %s", attachment.PreviewStatus, typesMessage.PreviewStatusReady)
+	}
+	if attachment.Width == nil || *attachment.Width != 100 || attachment.Height == nil || *attachment.Height != 50 {
+		t.Errorf("dimensions = %v x %v, want 100 x 50", attachment.Width, attachment.Height)
+	}
+	if attachment.PreviewStorageKey == nil {
+		t.Fatal("PreviewStorageKey is not set")
+	}
+
+	body, err := w.storage.Get(*attachment.PreviewStorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	preview, err := png.DecodeConfig(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Width != testMaxDimension || preview.Height != testMaxDimension/2 {
+		t.Errorf("preview = %d x %d, want %d x %d", preview.Width, preview.Height, testMaxDimension, testMaxDimension/2)
+	}
+
+	backlog, err := w.store.ReadOutboxBacklog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := 0
+	for _, event := range backlog.Events {
+		if event.EventType == servicesEvents.AttachmentUpdated {
+			updated++
+		}
+	}
+	if updated != 1 {
+		t.Errorf("outbox = %+v, want one %s event", backlog.Events, servicesEvents.AttachmentUpdated)
+	}
+}
+
+func TestProcessRecordsDimensionsOfOversizedImageWithoutPreview(t *testing.T) {
+	w := newTestWorker(t)
+	uploaded := w.upload(t, "a1", "image/gif", encodeOversizedGIF(t, 10000, 10000))
+
+	w.worker.process(job{attachment: uploaded})
+
+	attachment := w.read(t, "a1")
+	if attachment.PreviewStatus == nil || *attachment.PreviewStatus != typesMessage.PreviewStatusFailed {
+		t.Fatalf("PreviewStatus = %v, want %s", attachment.PreviewStatus, typesMessage.PreviewStatusFailed)
+	}
+	if attachment.Width == nil || *attachment.Width != 10000 || attachment.Height == nil || *attachment.Height != 10000 {
+		t.Errorf("dimensions = %v x %v, want 10000 x 10000", attachment.Width, attachment.Height)
+	}
+	if attachment.PreviewStorageKey != nil {
+		t.Errorf("PreviewStorageKey = %s, want none", *attachment.PreviewStorageKey)
+	}
+}
+
+func TestProcessMarksNonImageFailed(t *testing.T) {
+	w := newTestWorker(t)
+	uploaded := w.upload(t, "a1", "image/jpeg", []byte("not an image"))
+
+	w.worker.process(job{attachment: uploaded})
+
+	attachment := w.read(t, "a1")
+	if attachment.PreviewStatus == nil || *attachment.PreviewStatus != typesMessage.PreviewStatusFailed {
+		t.Fatalf("PreviewStatus = %v, want %s", attachment.PreviewStatus, typesMessage.PreviewStatusFailed)
+	}
+	if attachment.Width != nil || attachment.PreviewStorageKey != nil {
+		t.Errorf("attachment = %+v, want no dimensions or preview", attachment)
+	}
+}
+
+func TestProcessSkipsAttachmentClaimedElsewhere(t *testing.T) {
+	w := newTestWorker(t)
+	uploaded := w.upload(t, "a1", "image/png", encodePNG(t, 10, 10))
+
+	claimedAt := time.Now()
+	claimed, err := w.store.ClaimAttachmentPreview("a1", claimedAt, claimedAt.Add(-claimTTL))
+	if err != nil || !claimed {
+		t.Fatalf("ClaimAttachmentPreview() = %v, %v, want true", claimed, err)
+	}
+
+	w.worker.process(job{attachment: uploaded})
+	if attachment := w.read(t, "a1"); attachment.PreviewStatus != nil {
+		t.Fatalf("PreviewStatus = %s, want the other claim to keep it", *attachment.PreviewStatus)
+	}
+
+	pending, err := w.store.ClaimPendingPreviewAttachments(PreviewMimeTypes, queueSize, time.Now(), claimedAt.Add(-claimTTL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*pending) != 0 {
+		t.Errorf("claimed %+v while the first claim is fresh", *pending)
+	}
+	pending, err = w.store.ClaimPendingPreviewAttachments(PreviewMimeTypes, queueSize, time.Now(), claimedAt.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*pending) != 1 || (*pending)[0].AttachmentID != "a1" {
+		t.Errorf("claimed %+v, want the stale a1", *pending)
+	}
+}
+
+func TestEnqueueIgnoresNonImages(t *testing.T) {
+	w := newTestWorker(t)
+
+	w.worker.Enqueue(w.upload(t, "a1", "text/plain", []byte("note")))
+	if queued := len(w.worker.queue); queued != 0 {
+		t.Errorf("queued %d jobs, want none", queued)
+	}
+}
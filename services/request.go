@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
 	"github.com/google/uuid"
 	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
 	"golang.org/x/xerrors"
@@ -43,7 +44,10 @@ type AuthenticatorResponseData struct {
 func UserRequestParams(
 	requestWrapperController RequestWrapperController,
 ) *apiInputReader.Request {
-	businessPartner, _ := requestWrapperController.Controller.GetInt("businessPartner")
+	businessPartner, ok := AuthenticatedBusinessPartner(requestWrapperController.Controller.Ctx)
+	if !ok {
+		businessPartner, _ = requestWrapperController.Controller.GetInt("businessPartner")
+	}
 	businessPartnerRole := requestWrapperController.Controller.GetString("businessPartnerRole")
 	language := requestWrapperController.Controller.GetString("language")
 	userId := requestWrapperController.Controller.GetString("userId")
@@ -181,7 +185,7 @@ func HandleError(
 	controller.ServeJSON()
 
 	if statusCode != nil {
-		controller.Abort(fmt.Sprintf("%d", &statusCode))
+		controller.Abort(fmt.Sprintf("%d", *statusCode))
 	} else {
 		controller.Abort("500")
 	}
@@ -194,3 +198,15 @@ func Respond(
 	controller.Data["json"] = data
 	controller.ServeJSON()
 }
+
+// LimitRequestBodyFilter makes reading the request body fail after limit
+// bytes. beego parses forms before the BeforeRouter filters run, so it has to
+// be inserted at beego.BeforeStatic to take effect on multipart uploads.
+func LimitRequestBodyFilter(limit int64) beego.FilterFunc {
+	return func(ctx *context.Context) {
+		if ctx.Request.Body == nil {
+			return
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.ResponseWriter, ctx.Request.Body, limit)
+	}
+}
@@ -1,15 +1,31 @@
 package services
 
 import (
+	servicesEvents "data-platform-conversation-kube/services/events"
 	typesMessage "data-platform-conversation-kube/types/message"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	database "github.com/latonaio/golang-mysql-network-connector"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// MysqlStore is the ConversationStore backed by the data-platform MySQL
+// database.
+type MysqlStore struct {
+	db *database.Mysql
+}
+
+func NewMysqlStore(db *database.Mysql) *MysqlStore {
+	return &MysqlStore{db: db}
+}
+
+var _ ConversationStore = (*MysqlStore)(nil)
+
 type BusinessPartnerDoc struct {
 	BusinessPartner          int
 	DocType                  string
@@ -21,18 +37,1749 @@ type BusinessPartnerDoc struct {
 	DocIssuerBusinessPartner *int
 }
 
-func CreateChatRoom(
-	db *database.Mysql,
-	roomCreator int,
-	roomPartner int,
-) (*string, error) {
-	now := time.Now()
-	chatRoom := uuid.New().String()
+// CreateChatRoom returns the direct room of the two business partners,
+// creating it when they have none yet. The second return value tells whether
+// the room was created by this call.
+func (s *MysqlStore) CreateChatRoom(
+	roomCreator int,
+	roomPartner int,
+) (room *string, created bool, err error) {
+	now := time.Now()
+	chatRoom := uuid.New().String()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_header_data (
+            ChatRoom,
+            RoomType,
+            RoomCreator,
+            RoomPartner,
+            CreatedAt,
+            UpdatedAt
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+	_, err = tx.Exec(
+		insertQuery,
+		chatRoom,
+		typesMessage.RoomTypeDirect,
+		roomCreator,
+		roomPartner,
+		now,
+		now,
+	)
+	if isDuplicateEntry(err) {
+		// The pair already has a room: DirectRoomPairKey is unique, so of
+		// two concurrent creates only one inserts. The failed statement is
+		// rolled back on its own and the transaction stays usable; the
+		// locking read sees the other create once it has committed.
+		existingQuery := `
+            SELECT ChatRoom
+            FROM data_platform_chat_room_header_data
+            WHERE RoomType = ?
+              AND ((RoomCreator = ? AND RoomPartner = ?)
+               OR (RoomCreator = ? AND RoomPartner = ?))
+            LOCK IN SHARE MODE
+        `
+		var existingRoomID string
+		err = tx.QueryRow(
+			existingQuery,
+			typesMessage.RoomTypeDirect,
+			roomCreator,
+			roomPartner,
+			roomPartner,
+			roomCreator,
+		).Scan(&existingRoomID)
+		if err != nil {
+			return nil, false, err
+		}
+		return &existingRoomID, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.RoomCreated,
+		chatRoom,
+		servicesEvents.RoomCreatedPayload{
+			RoomType:     typesMessage.RoomTypeDirect,
+			RoomCreator:  roomCreator,
+			Participants: []int{roomCreator, roomPartner},
+		},
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &chatRoom, true, nil
+}
+
+func (s *MysqlStore) CreateGroupChatRoom(
+	roomCreator int,
+	participants []int,
+	title string,
+) (room *string, err error) {
+	now := time.Now()
+	chatRoom := uuid.New().String()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_header_data (
+            ChatRoom,
+            RoomType,
+            Title,
+            RoomCreator,
+            CreatedAt,
+            UpdatedAt
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+	_, err = tx.Exec(
+		insertQuery,
+		chatRoom,
+		typesMessage.RoomTypeGroup,
+		title,
+		roomCreator,
+		now,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	insertParticipantQuery := `
+        INSERT INTO data_platform_chat_room_participant_data (
+            ChatRoom,
+            Participant,
+            JoinedAt
+        ) VALUES (?, ?, ?)
+    `
+	for _, participant := range participants {
+		_, err = tx.Exec(insertParticipantQuery, chatRoom, participant, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.RoomCreated,
+		chatRoom,
+		servicesEvents.RoomCreatedPayload{
+			RoomType:     typesMessage.RoomTypeGroup,
+			RoomCreator:  roomCreator,
+			Participants: participants,
+			Title:        &title,
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &chatRoom, nil
+}
+
+// chatRoomMembersQuery lists every (ChatRoom, Participant) pair. 1:1 rooms
+// only carry RoomCreator and RoomPartner on the header while group rooms
+// list their members in the participant table.
+const chatRoomMembersQuery = `
+        SELECT ChatRoom, RoomCreator AS Participant
+        FROM data_platform_chat_room_header_data
+        UNION
+        SELECT ChatRoom, RoomPartner AS Participant
+        FROM data_platform_chat_room_header_data
+        WHERE RoomPartner IS NOT NULL
+        UNION
+        SELECT ChatRoom, Participant
+        FROM data_platform_chat_room_participant_data
+`
+
+func (s *MysqlStore) IsChatRoomMember(
+	chatRoom string,
+	businessPartner int,
+) (bool, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM (` + chatRoomMembersQuery + `) AS member
+        WHERE member.ChatRoom = ?
+          AND member.Participant = ?
+    `
+	var count int
+	err := s.db.QueryRow(query, chatRoom, businessPartner).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *MysqlStore) SharesChatRoom(
+	businessPartner int,
+	counterpart int,
+) (bool, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM (` + chatRoomMembersQuery + `) AS member
+        JOIN (` + chatRoomMembersQuery + `) AS counterpart
+        ON member.ChatRoom = counterpart.ChatRoom
+        WHERE member.Participant = ?
+          AND counterpart.Participant = ?
+    `
+	var count int
+	err := s.db.QueryRow(query, businessPartner, counterpart).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CounterpartsSharingChatRoom reports, for each of counterparts, whether it
+// shares at least one chat room with businessPartner, in a single query.
+func (s *MysqlStore) CounterpartsSharingChatRoom(
+	businessPartner int,
+	counterparts []int,
+) (map[int]bool, error) {
+	sharing := make(map[int]bool, len(counterparts))
+	if len(counterparts) == 0 {
+		return sharing, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(counterparts)-1) + "?"
+	query := `
+        SELECT DISTINCT counterpart.Participant
+        FROM (` + chatRoomMembersQuery + `) AS member
+        JOIN (` + chatRoomMembersQuery + `) AS counterpart
+        ON member.ChatRoom = counterpart.ChatRoom
+        WHERE member.Participant = ?
+          AND counterpart.Participant IN (` + placeholders + `)
+    `
+	args := append([]interface{}{businessPartner}, toInterfaceSlice(counterparts)...)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var counterpart int
+		if err := rows.Scan(&counterpart); err != nil {
+			return nil, err
+		}
+		sharing[counterpart] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sharing, nil
+}
+
+// ReadChatRooms returns one page of the chat rooms the business partner
+// belongs to, ordered by the latest message or else the room creation time.
+func (s *MysqlStore) ReadChatRooms(
+	businessPartner int,
+	ascending bool,
+	limit int,
+	offset int,
+) (*[]typesMessage.ChatRoomSummary, error) {
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+
+	query := `
+        SELECT
+            room.ChatRoom,
+            room.RoomType,
+            room.Title,
+            CONCAT(DATE_FORMAT(room.CreatedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(room.CreatedAt) / 1000), 3, '0')) AS CreatedAt,
+            CONCAT(DATE_FORMAT(COALESCE(lastMessage.SentAt, room.CreatedAt), '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(COALESCE(lastMessage.SentAt, room.CreatedAt)) / 1000), 3, '0')) AS LastActivityAt,
+            lastMessage.MessageID,
+            lastMessage.BusinessPartner,
+            CASE WHEN lastMessage.DeletedAt IS NULL THEN lastMessage.Content ELSE '' END AS Content,
+            CONCAT(DATE_FORMAT(lastMessage.SentAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(lastMessage.SentAt) / 1000), 3, '0')) AS SentAt,
+            (
+                SELECT COUNT(*)
+                FROM data_platform_chat_room_message_data AS message
+                LEFT JOIN data_platform_chat_room_message_read_status_data AS messageReadStatus
+                ON message.MessageID = messageReadStatus.MessageID
+                   AND messageReadStatus.Participant = ?
+                LEFT JOIN data_platform_chat_room_read_watermark_data AS watermark
+                ON watermark.ChatRoom = message.ChatRoom
+                   AND watermark.Participant = ?
+                WHERE message.ChatRoom = room.ChatRoom
+                  AND message.BusinessPartner <> ?
+                  AND messageReadStatus.ReadStatusID IS NULL
+                  AND (
+                      watermark.LastReadSentAt IS NULL
+                      OR message.SentAt > watermark.LastReadSentAt
+                      OR (message.SentAt = watermark.LastReadSentAt AND message.MessageID > watermark.LastReadMessageID)
+                  )
+            ) AS UnreadCount
+        FROM (
+            SELECT DISTINCT member.ChatRoom
+            FROM (` + chatRoomMembersQuery + `) AS member
+            WHERE member.Participant = ?
+        ) AS membership
+        JOIN data_platform_chat_room_header_data AS room
+        ON room.ChatRoom = membership.ChatRoom
+        LEFT JOIN data_platform_chat_room_message_data AS lastMessage
+        ON lastMessage.MessageID = (
+            SELECT message.MessageID
+            FROM data_platform_chat_room_message_data AS message
+            WHERE message.ChatRoom = room.ChatRoom
+            ORDER BY message.SentAt DESC, message.MessageID DESC
+            LIMIT 1
+        )
+        ORDER BY COALESCE(lastMessage.SentAt, room.CreatedAt) ` + order + `, room.ChatRoom ` + order + `
+        LIMIT ? OFFSET ?
+    `
+	rows, err := s.db.Query(
+		query,
+		businessPartner,
+		businessPartner,
+		businessPartner,
+		businessPartner,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatRooms []typesMessage.ChatRoomSummary
+	for rows.Next() {
+		var chatRoom typesMessage.ChatRoomSummary
+		var title sql.NullString
+		var messageID sql.NullString
+		var sender sql.NullInt64
+		var content sql.NullString
+		var sentAt sql.NullString
+
+		if err := rows.Scan(
+			&chatRoom.ChatRoom,
+			&chatRoom.RoomType,
+			&title,
+			&chatRoom.CreatedAt,
+			&chatRoom.LastActivityAt,
+			&messageID,
+			&sender,
+			&content,
+			&sentAt,
+			&chatRoom.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+
+		if title.Valid {
+			chatRoom.Title = &title.String
+		}
+		if messageID.Valid {
+			chatRoom.LastMessage = &typesMessage.LastMessage{
+				MessageID:       messageID.String,
+				BusinessPartner: int(sender.Int64),
+				Content:         content.String,
+				SentAt:          sentAt.String,
+			}
+		}
+
+		chatRooms = append(chatRooms, chatRoom)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &chatRooms, nil
+}
+
+func (s *MysqlStore) ReadChatRoomIDs(
+	businessPartner int,
+) ([]string, error) {
+	query := `
+        SELECT DISTINCT member.ChatRoom
+        FROM (` + chatRoomMembersQuery + `) AS member
+        WHERE member.Participant = ?
+    `
+	rows, err := s.db.Query(query, businessPartner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatRooms []string
+	for rows.Next() {
+		var chatRoom string
+		if err := rows.Scan(&chatRoom); err != nil {
+			return nil, err
+		}
+		chatRooms = append(chatRooms, chatRoom)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return chatRooms, nil
+}
+
+func (s *MysqlStore) ReadChatRoomsMembers(
+	chatRooms []string,
+) (map[string][]int, error) {
+	members := make(map[string][]int)
+	if len(chatRooms) == 0 {
+		return members, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(chatRooms)-1) + "?"
+	query := `
+        SELECT member.ChatRoom, member.Participant
+        FROM (` + chatRoomMembersQuery + `) AS member
+        WHERE member.ChatRoom IN (` + placeholders + `)
+    `
+	rows, err := s.db.Query(query, toStringInterfaceSlice(chatRooms)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatRoom string
+		var participant int
+		if err := rows.Scan(&chatRoom, &participant); err != nil {
+			return nil, err
+		}
+		members[chatRoom] = append(members[chatRoom], participant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// ReadConversationHistoryWithReadStatus returns one page of messages in
+// chronological order. Without a cursor the newest page is returned; before
+// pages backwards and after pages forwards. The returned cursor points at the
+// next page in the same direction and is nil when there is none.
+func (s *MysqlStore) ReadConversationHistoryWithReadStatus(
+	chatRoom string,
+	viewer int,
+	before *typesMessage.HistoryCursor,
+	after *typesMessage.HistoryCursor,
+	limit int,
+) (*[]typesMessage.ConversationHistoryWithReadStatus, *typesMessage.HistoryCursor, error) {
+	args := []interface{}{chatRoom, viewer}
+	condition := ""
+	order := "DESC"
+	if before != nil {
+		condition = "AND (SentAt < ? OR (SentAt = ? AND MessageID < ?))"
+		args = append(args, before.SentAt, before.SentAt, before.MessageID)
+	} else if after != nil {
+		condition = "AND (SentAt > ? OR (SentAt = ? AND MessageID > ?))"
+		args = append(args, after.SentAt, after.SentAt, after.MessageID)
+		order = "ASC"
+	}
+	// One extra row tells whether another page exists.
+	args = append(args, limit+1)
+
+	query := `
+        SELECT 
+            message.MessageID, 
+            message.ChatRoom, 
+            message.BusinessPartner, 
+            message.SenderType, 
+            message.ReplyTo, 
+            message.Sequence, 
+            CASE WHEN message.DeletedAt IS NULL THEN message.Content ELSE '' END AS Content, 
+            CONCAT(DATE_FORMAT(message.SentAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.SentAt) / 1000), 3, '0')) AS SentAt,
+            CONCAT(DATE_FORMAT(message.EditedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.EditedAt) / 1000), 3, '0')) AS EditedAt,
+            CONCAT(DATE_FORMAT(message.DeletedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.DeletedAt) / 1000), 3, '0')) AS DeletedAt,
+            DATE_FORMAT(message.SentAt, '%Y-%m-%d %H:%i:%s.%f') AS CursorSentAt,
+            (
+                SELECT GROUP_CONCAT(watermark.Participant)
+                FROM data_platform_chat_room_read_watermark_data AS watermark
+                WHERE watermark.ChatRoom = message.ChatRoom
+                  AND watermark.Participant <> message.BusinessPartner
+                  AND (
+                      watermark.LastReadSentAt > message.SentAt
+                      OR (watermark.LastReadSentAt = message.SentAt AND watermark.LastReadMessageID >= message.MessageID)
+                  )
+            ) AS ReadParticipants,
+            messageReadStatus.ReadStatusID,
+            messageReadStatus.Participant,
+            CONCAT(DATE_FORMAT(messageReadStatus.ReadAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(messageReadStatus.ReadAt) / 1000), 3, '0')) AS ReadAt
+        FROM (
+            SELECT MessageID, ChatRoom, BusinessPartner, SenderType, ReplyTo, Sequence, Content, SentAt, EditedAt, DeletedAt
+            FROM data_platform_chat_room_message_data AS message
+            WHERE ChatRoom = ?
+            AND NOT EXISTS (
+                SELECT 1
+                FROM data_platform_chat_room_message_deletion_data AS deletion
+                WHERE deletion.MessageID = message.MessageID
+                  AND deletion.BusinessPartner = ?
+            )
+            ` + condition + `
+            ORDER BY SentAt ` + order + `, MessageID ` + order + `
+            LIMIT ?
+        ) AS message
+        LEFT JOIN 
+            data_platform_chat_room_message_read_status_data AS messageReadStatus
+        ON 
+            message.MessageID = messageReadStatus.MessageID
+        ORDER BY 
+            message.SentAt ` + order + `, message.MessageID ` + order + `
+    `
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var histories []typesMessage.ConversationHistoryWithReadStatus
+	var cursors []typesMessage.HistoryCursor
+	for rows.Next() {
+		var history typesMessage.ConversationHistoryWithReadStatus
+		var replyTo sql.NullString
+		var editedAt sql.NullString
+		var deletedAt sql.NullString
+		var cursorSentAt string
+		var readParticipants sql.NullString
+		var readStatusID sql.NullString
+		var readBy sql.NullInt64
+		var readAt sql.NullString
+
+		if err := rows.Scan(
+			&history.MessageID,
+			&history.ChatRoom,
+			&history.BusinessPartner,
+			&history.SenderType,
+			&replyTo,
+			&history.Sequence,
+			&history.Content,
+			&history.SentAt,
+			&editedAt,
+			&deletedAt,
+			&cursorSentAt,
+			&readParticipants,
+			&readStatusID,
+			&readBy,
+			&readAt,
+		); err != nil {
+			return nil, nil, err
+		}
+
+		if replyTo.Valid {
+			history.ReplyTo = &replyTo.String
+		}
+		if editedAt.Valid {
+			history.EditedAt = &editedAt.String
+		}
+		if deletedAt.Valid {
+			history.DeletedAt = &deletedAt.String
+		}
+		if readParticipants.Valid {
+			history.ReadParticipants, err = parseIntList(readParticipants.String)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if readStatusID.Valid {
+			history.ReadStatusID = &readStatusID.String
+		}
+		if readBy.Valid {
+			participant := int(readBy.Int64)
+			history.ReadBy = &participant
+		}
+		if readAt.Valid {
+			history.ReadAt = &readAt.String
+		}
+
+		if len(cursors) == 0 || cursors[len(cursors)-1].MessageID != history.MessageID {
+			cursors = append(cursors, typesMessage.HistoryCursor{
+				SentAt:    cursorSentAt,
+				MessageID: history.MessageID,
+			})
+		}
+		histories = append(histories, history)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var nextCursor *typesMessage.HistoryCursor
+	if len(cursors) > limit {
+		overflow := cursors[limit].MessageID
+		for len(histories) > 0 && histories[len(histories)-1].MessageID == overflow {
+			histories = histories[:len(histories)-1]
+		}
+		nextCursor = &cursors[limit-1]
+	}
+
+	if order == "DESC" {
+		for i, j := 0, len(histories)-1; i < j; i, j = i+1, j-1 {
+			histories[i], histories[j] = histories[j], histories[i]
+		}
+	}
+
+	return &histories, nextCursor, nil
+}
+
+// InsertConversationHistory stores the message and assigns it the next
+// sequence of the room. Sends are idempotent on (ChatRoom, MessageID): when
+// an earlier attempt of the same sender already stored the message, nothing
+// is written and its original acceptance is returned with duplicate set.
+// System messages are stored with SenderType System and business partner 0.
+func (s *MysqlStore) InsertConversationHistory(
+	chatRoom string,
+	businessPartner int,
+	senderType string,
+	messageID string,
+	message string,
+	sentAt string,
+	replyTo *string,
+	attachmentIDs []string,
+) (accepted *typesMessage.MessageAccepted, duplicate bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// The header row lock serialises concurrent senders, so sequences are
+	// gap-free and follow commit order within the room, and a retry racing
+	// its original attempt sees the stored message.
+	lockQuery := `
+        SELECT LastSequence
+        FROM data_platform_chat_room_header_data
+        WHERE ChatRoom = ?
+        FOR UPDATE
+    `
+	var lastSequence int64
+	err = tx.QueryRow(lockQuery, chatRoom).Scan(&lastSequence)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrChatRoomNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// MessageID is unique across rooms, so a retry is only recognised in the
+	// room and from the sender of the stored message.
+	duplicateQuery := `
+        SELECT
+            ChatRoom,
+            BusinessPartner,
+            SenderType,
+            DATE_FORMAT(SentAt, '%Y-%m-%d %H:%i:%s.%f'),
+            Sequence
+        FROM data_platform_chat_room_message_data
+        WHERE MessageID = ?
+    `
+	var storedChatRoom string
+	var sender int
+	var storedSenderType string
+	var storedSentAt string
+	var storedSequence int64
+	err = tx.QueryRow(duplicateQuery, messageID).Scan(&storedChatRoom, &sender, &storedSenderType, &storedSentAt, &storedSequence)
+	switch {
+	case err == nil:
+		if storedChatRoom != chatRoom || sender != businessPartner || storedSenderType != senderType {
+			err = ErrMessageIDConflict
+			return nil, false, err
+		}
+		var parsed time.Time
+		parsed, err = time.Parse("2006-01-02 15:04:05.999999", storedSentAt)
+		if err != nil {
+			return nil, false, err
+		}
+		return &typesMessage.MessageAccepted{
+			MessageID: messageID,
+			ChatRoom:  chatRoom,
+			SentAt:    parsed.Format("2006-01-02 15:04:05.999999"),
+			Sequence:  storedSequence,
+		}, true, nil
+	case err != sql.ErrNoRows:
+		return nil, false, err
+	}
+	err = nil
+
+	if replyTo != nil {
+		var count int
+		selectQuery := `
+            SELECT COUNT(*)
+            FROM data_platform_chat_room_message_data
+            WHERE ChatRoom = ? AND MessageID = ?
+        `
+		err = tx.QueryRow(selectQuery, chatRoom, *replyTo).Scan(&count)
+		if err != nil {
+			return nil, false, err
+		}
+		if count == 0 {
+			err = ErrReplyToNotFound
+			return nil, false, err
+		}
+	}
+
+	sequence := lastSequence + 1
+	sequenceQuery := `
+        UPDATE data_platform_chat_room_header_data
+        SET LastSequence = ?
+        WHERE ChatRoom = ?
+    `
+	_, err = tx.Exec(sequenceQuery, sequence, chatRoom)
+	if err != nil {
+		return nil, false, err
+	}
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_message_data (
+            MessageID,
+            ChatRoom,
+            BusinessPartner,
+            SenderType,
+            Content,
+            SentAt,
+            ReplyTo,
+            Sequence
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err = tx.Exec(insertQuery, messageID, chatRoom, businessPartner, senderType, message, sentAt, replyTo, sequence)
+	if isDuplicateEntry(err) {
+		// Another room took the MessageID after the lookup above.
+		err = ErrMessageIDConflict
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(attachmentIDs) > 0 {
+		placeholders := strings.Repeat("?,", len(attachmentIDs)-1) + "?"
+		updateQuery := `
+            UPDATE data_platform_chat_room_attachment_data
+            SET MessageID = ?
+            WHERE ChatRoom = ?
+              AND Uploader = ?
+              AND MessageID IS NULL
+              AND AttachmentID IN (` + placeholders + `)
+        `
+		args := append(
+			[]interface{}{messageID, chatRoom, businessPartner},
+			toStringInterfaceSlice(attachmentIDs)...,
+		)
+		var result sql.Result
+		result, err = tx.Exec(updateQuery, args...)
+		if err != nil {
+			return nil, false, err
+		}
+		var linked int64
+		linked, err = result.RowsAffected()
+		if err != nil {
+			return nil, false, err
+		}
+		if linked != int64(len(attachmentIDs)) {
+			err = ErrAttachmentInvalid
+			return nil, false, err
+		}
+	}
+
+	err = insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.MessageSent,
+		chatRoom,
+		servicesEvents.MessageSentPayload{
+			MessageID:   messageID,
+			Sender:      businessPartner,
+			SenderType:  senderType,
+			Content:     message,
+			SentAt:      sentAt,
+			Sequence:    sequence,
+			ReplyTo:     replyTo,
+			Attachments: attachmentIDs,
+		},
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &typesMessage.MessageAccepted{
+		MessageID: messageID,
+		ChatRoom:  chatRoom,
+		SentAt:    sentAt,
+		Sequence:  sequence,
+	}, false, err
+}
+
+// ReadMessagesAfterSequence returns up to limit messages of the room with a
+// sequence greater than afterSequence, oldest first, hiding messages the
+// viewer deleted for themselves.
+func (s *MysqlStore) ReadMessagesAfterSequence(
+	chatRoom string,
+	viewer int,
+	afterSequence int64,
+	limit int,
+) (*[]typesMessage.SequencedMessage, error) {
+	query := `
+        SELECT
+            message.MessageID,
+            message.ChatRoom,
+            message.BusinessPartner,
+            message.SenderType,
+            message.ReplyTo,
+            CASE WHEN message.DeletedAt IS NULL THEN message.Content ELSE '' END AS Content,
+            CONCAT(DATE_FORMAT(message.SentAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.SentAt) / 1000), 3, '0')) AS SentAt,
+            CONCAT(DATE_FORMAT(message.EditedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.EditedAt) / 1000), 3, '0')) AS EditedAt,
+            CONCAT(DATE_FORMAT(message.DeletedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.DeletedAt) / 1000), 3, '0')) AS DeletedAt,
+            message.Sequence
+        FROM data_platform_chat_room_message_data AS message
+        WHERE message.ChatRoom = ?
+          AND message.Sequence > ?
+          AND NOT EXISTS (
+              SELECT 1
+              FROM data_platform_chat_room_message_deletion_data AS deletion
+              WHERE deletion.MessageID = message.MessageID
+                AND deletion.BusinessPartner = ?
+          )
+        ORDER BY message.Sequence ASC
+        LIMIT ?
+    `
+	rows, err := s.db.Query(query, chatRoom, afterSequence, viewer, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []typesMessage.SequencedMessage
+	for rows.Next() {
+		var message typesMessage.SequencedMessage
+		var replyTo sql.NullString
+		var editedAt sql.NullString
+		var deletedAt sql.NullString
+		if err := rows.Scan(
+			&message.MessageID,
+			&message.ChatRoom,
+			&message.BusinessPartner,
+			&message.SenderType,
+			&replyTo,
+			&message.Content,
+			&message.SentAt,
+			&editedAt,
+			&deletedAt,
+			&message.Sequence,
+		); err != nil {
+			return nil, err
+		}
+		if replyTo.Valid {
+			message.ReplyTo = &replyTo.String
+		}
+		if editedAt.Valid {
+			message.EditedAt = &editedAt.String
+		}
+		if deletedAt.Valid {
+			message.DeletedAt = &deletedAt.String
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &messages, nil
+}
+
+// EditMessage replaces the content of a message sent by editor within the
+// edit window and keeps the replaced content as a revision.
+func (s *MysqlStore) EditMessage(
+	chatRoom string,
+	messageID string,
+	editor int,
+	content string,
+	editedAt time.Time,
+	editWindow time.Duration,
+) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	selectQuery := `
+        SELECT BusinessPartner, Content, SentAt >= ? AS WithinEditWindow
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ? AND DeletedAt IS NULL
+        FOR UPDATE
+    `
+	var sender int
+	var previousContent string
+	var withinEditWindow bool
+	err = tx.QueryRow(
+		selectQuery,
+		editedAt.Add(-editWindow).Format("2006-01-02 15:04:05.999999"),
+		chatRoom,
+		messageID,
+	).Scan(&sender, &previousContent, &withinEditWindow)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrMessageNotFound
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if sender != editor {
+		err = ErrNotMessageSender
+		return err
+	}
+	if !withinEditWindow {
+		err = ErrEditWindowExpired
+		return err
+	}
+
+	insertRevisionQuery := `
+        INSERT INTO data_platform_chat_room_message_revision_data (
+            RevisionID,
+            MessageID,
+            Content,
+            EditedAt
+        ) VALUES (?, ?, ?, ?)
+    `
+	_, err = tx.Exec(
+		insertRevisionQuery,
+		uuid.New().String(),
+		messageID,
+		previousContent,
+		editedAt.Format("2006-01-02 15:04:05.999999"),
+	)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `
+        UPDATE data_platform_chat_room_message_data
+        SET Content = ?, EditedAt = ?
+        WHERE ChatRoom = ? AND MessageID = ?
+    `
+	_, err = tx.Exec(
+		updateQuery,
+		content,
+		editedAt.Format("2006-01-02 15:04:05.999999"),
+		chatRoom,
+		messageID,
+	)
+	return err
+}
+
+// DeleteMessageForEveryone leaves a tombstone on a message sent by
+// businessPartner. The row is kept so read receipts and audit stay intact;
+// histories redact its content.
+func (s *MysqlStore) DeleteMessageForEveryone(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	deletedAt string,
+) error {
+	var sender int
+	selectQuery := `
+        SELECT BusinessPartner
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ? AND DeletedAt IS NULL
+    `
+	err := s.db.QueryRow(selectQuery, chatRoom, messageID).Scan(&sender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMessageNotFound
+	} else if err != nil {
+		return err
+	}
+	if sender != businessPartner {
+		return ErrNotMessageSender
+	}
+
+	updateQuery := `
+        UPDATE data_platform_chat_room_message_data
+        SET DeletedAt = ?, DeletedBy = ?
+        WHERE ChatRoom = ? AND MessageID = ? AND DeletedAt IS NULL
+    `
+	_, err = s.db.Exec(updateQuery, deletedAt, businessPartner, chatRoom, messageID)
+	return err
+}
+
+// DeleteMessageForSelf hides a message from the histories of businessPartner
+// only.
+func (s *MysqlStore) DeleteMessageForSelf(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	deletedAt string,
+) error {
+	var count int
+	selectQuery := `
+        SELECT COUNT(*)
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ?
+    `
+	err := s.db.QueryRow(selectQuery, chatRoom, messageID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrMessageNotFound
+	}
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_message_deletion_data (
+            MessageID,
+            BusinessPartner,
+            DeletedAt
+        ) VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE DeletedAt = DeletedAt
+    `
+	_, err = s.db.Exec(insertQuery, messageID, businessPartner, deletedAt)
+	return err
+}
+
+func (s *MysqlStore) ReadMessageRevisions(
+	messageIDs []string,
+) (map[string][]typesMessage.MessageRevision, error) {
+	revisions := make(map[string][]typesMessage.MessageRevision)
+	if len(messageIDs) == 0 {
+		return revisions, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(messageIDs)-1) + "?"
+	query := `
+        SELECT
+            RevisionID,
+            MessageID,
+            Content,
+            CONCAT(DATE_FORMAT(EditedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(EditedAt) / 1000), 3, '0')) AS EditedAt
+        FROM data_platform_chat_room_message_revision_data
+        WHERE MessageID IN (` + placeholders + `)
+        ORDER BY EditedAt ASC
+    `
+	rows, err := s.db.Query(query, toStringInterfaceSlice(messageIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision typesMessage.MessageRevision
+		if err := rows.Scan(
+			&revision.RevisionID,
+			&revision.MessageID,
+			&revision.Content,
+			&revision.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		revisions[revision.MessageID] = append(revisions[revision.MessageID], revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+const maxEmojiLength = 32
+
+func (s *MysqlStore) AddReaction(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	emoji string,
+	reactedAt string,
+) error {
+	if emoji == "" || len(emoji) > maxEmojiLength {
+		return ErrInvalidEmoji
+	}
+
+	var count int
+	selectQuery := `
+        SELECT COUNT(*)
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ? AND DeletedAt IS NULL
+    `
+	err := s.db.QueryRow(selectQuery, chatRoom, messageID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrMessageNotFound
+	}
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_message_reaction_data (
+            MessageID,
+            BusinessPartner,
+            Emoji,
+            ReactedAt
+        ) VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE ReactedAt = ReactedAt
+    `
+	_, err = s.db.Exec(insertQuery, messageID, businessPartner, emoji, reactedAt)
+	return err
+}
+
+func (s *MysqlStore) RemoveReaction(
+	chatRoom string,
+	messageID string,
+	businessPartner int,
+	emoji string,
+) error {
+	deleteQuery := `
+        DELETE reaction
+        FROM data_platform_chat_room_message_reaction_data AS reaction
+        JOIN data_platform_chat_room_message_data AS message
+        ON message.MessageID = reaction.MessageID
+        WHERE message.ChatRoom = ?
+          AND reaction.MessageID = ?
+          AND reaction.BusinessPartner = ?
+          AND reaction.Emoji = ?
+    `
+	_, err := s.db.Exec(deleteQuery, chatRoom, messageID, businessPartner, emoji)
+	return err
+}
+
+// ReadMessageReactions aggregates the reactions of each message by emoji in
+// the order each emoji was first used.
+func (s *MysqlStore) ReadMessageReactions(
+	messageIDs []string,
+) (map[string][]typesMessage.ReactionCount, error) {
+	reactions := make(map[string][]typesMessage.ReactionCount)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(messageIDs)-1) + "?"
+	query := `
+        SELECT MessageID, Emoji, BusinessPartner
+        FROM data_platform_chat_room_message_reaction_data
+        WHERE MessageID IN (` + placeholders + `)
+        ORDER BY ReactedAt ASC
+    `
+	rows, err := s.db.Query(query, toStringInterfaceSlice(messageIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var emoji string
+		var businessPartner int
+		if err := rows.Scan(&messageID, &emoji, &businessPartner); err != nil {
+			return nil, err
+		}
+
+		counts := reactions[messageID]
+		found := false
+		for i := range counts {
+			if counts[i].Emoji == emoji {
+				counts[i].Count++
+				counts[i].BusinessPartners = append(counts[i].BusinessPartners, businessPartner)
+				found = true
+				break
+			}
+		}
+		if !found {
+			counts = append(counts, typesMessage.ReactionCount{
+				Emoji:            emoji,
+				Count:            1,
+				BusinessPartners: []int{businessPartner},
+			})
+		}
+		reactions[messageID] = counts
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
+
+func AttachmentURL(chatRoom string, attachmentID string) string {
+	return fmt.Sprintf("/api/conversation/message/attachments/%s/%s", chatRoom, attachmentID)
+}
+
+func (s *MysqlStore) InsertAttachment(
+	attachment typesMessage.Attachment,
+) error {
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_attachment_data (
+            AttachmentID,
+            ChatRoom,
+            Uploader,
+            FileName,
+            MimeType,
+            Size,
+            StorageKey,
+            CreatedAt
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err := s.db.Exec(
+		insertQuery,
+		attachment.AttachmentID,
+		attachment.ChatRoom,
+		attachment.Uploader,
+		attachment.FileName,
+		attachment.MimeType,
+		attachment.Size,
+		attachment.StorageKey,
+		attachment.CreatedAt,
+	)
+	return err
+}
+
+const attachmentColumns = `
+            AttachmentID,
+            ChatRoom,
+            MessageID,
+            Uploader,
+            FileName,
+            MimeType,
+            Size,
+            StorageKey,
+            CONCAT(DATE_FORMAT(CreatedAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(CreatedAt) / 1000), 3, '0')) AS CreatedAt,
+            Width,
+            Height,
+            PreviewStatus,
+            PreviewStorageKey,
+            PreviewMimeType
+`
+
+func scanAttachment(row interface{ Scan(...any) error }) (*typesMessage.Attachment, error) {
+	var attachment typesMessage.Attachment
+	var messageID sql.NullString
+	var width sql.NullInt64
+	var height sql.NullInt64
+	var previewStatus sql.NullString
+	var previewStorageKey sql.NullString
+	var previewMimeType sql.NullString
+	if err := row.Scan(
+		&attachment.AttachmentID,
+		&attachment.ChatRoom,
+		&messageID,
+		&attachment.Uploader,
+		&attachment.FileName,
+		&attachment.MimeType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&attachment.CreatedAt,
+		&width,
+		&height,
+		&previewStatus,
+		&previewStorageKey,
+		&previewMimeType,
+	); err != nil {
+		return nil, err
+	}
+	if messageID.Valid {
+		attachment.MessageID = &messageID.String
+	}
+	if width.Valid && height.Valid {
+		w, h := int(width.Int64), int(height.Int64)
+		attachment.Width = &w
+		attachment.Height = &h
+	}
+	if previewStatus.Valid {
+		attachment.PreviewStatus = &previewStatus.String
+	}
+	if previewStorageKey.Valid {
+		attachment.PreviewStorageKey = &previewStorageKey.String
+		previewURL := AttachmentURL(attachment.ChatRoom, attachment.AttachmentID) + "/preview"
+		attachment.PreviewURL = &previewURL
+	}
+	if previewMimeType.Valid {
+		attachment.PreviewMimeType = &previewMimeType.String
+	}
+	attachment.URL = AttachmentURL(attachment.ChatRoom, attachment.AttachmentID)
+	return &attachment, nil
+}
+
+// ReadAttachment returns an attachment of the room. Attachments of a message
+// deleted for everyone are reported as ErrAttachmentMissing.
+func (s *MysqlStore) ReadAttachment(
+	chatRoom string,
+	attachmentID string,
+) (*typesMessage.Attachment, error) {
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM data_platform_chat_room_attachment_data AS attachment
+        WHERE ChatRoom = ? AND AttachmentID = ?
+          AND NOT EXISTS (
+              SELECT 1
+              FROM data_platform_chat_room_message_data AS message
+              WHERE message.MessageID = attachment.MessageID
+                AND message.DeletedAt IS NOT NULL
+          )
+    `
+	attachment, err := scanAttachment(s.db.QueryRow(query, chatRoom, attachmentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttachmentMissing
+	}
+	return attachment, err
+}
+
+// ReadPendingPreviewAttachments lists image attachments whose preview has
+// not been generated yet, e.g. because the pod restarted mid-queue.
+// ClaimPendingPreviewAttachments locks the rows with SKIP LOCKED before
+// claiming them, so workers on several pods never take the same attachment.
+func (s *MysqlStore) ClaimPendingPreviewAttachments(
+	mimeTypes []string,
+	limit int,
+	claimedAt time.Time,
+	staleBefore time.Time,
+) (claimed *[]typesMessage.Attachment, err error) {
+	var attachments []typesMessage.Attachment
+	if len(mimeTypes) == 0 || limit <= 0 {
+		return &attachments, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	placeholders := strings.Repeat("?,", len(mimeTypes)-1) + "?"
+	selectQuery := `
+        SELECT ` + attachmentColumns + `
+        FROM data_platform_chat_room_attachment_data
+        WHERE PreviewStatus IS NULL
+          AND MimeType IN (` + placeholders + `)
+          AND (PreviewClaimedAt IS NULL OR PreviewClaimedAt < ?)
+        ORDER BY CreatedAt ASC
+        LIMIT ?
+        FOR UPDATE SKIP LOCKED
+    `
+	args := append(
+		toStringInterfaceSlice(mimeTypes),
+		staleBefore.Format("2006-01-02 15:04:05.999999"),
+		limit,
+	)
+	rows, err := tx.Query(selectQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	var attachmentIDs []string
+	for rows.Next() {
+		var attachment *typesMessage.Attachment
+		attachment, err = scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+		attachmentIDs = append(attachmentIDs, attachment.AttachmentID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(attachmentIDs) == 0 {
+		return &attachments, nil
+	}
+
+	updateQuery := `
+        UPDATE data_platform_chat_room_attachment_data
+        SET PreviewClaimedAt = ?
+        WHERE AttachmentID IN (` + strings.Repeat("?,", len(attachmentIDs)-1) + `?)
+    `
+	_, err = tx.Exec(
+		updateQuery,
+		append(
+			[]interface{}{claimedAt.Format("2006-01-02 15:04:05.999999")},
+			toStringInterfaceSlice(attachmentIDs)...,
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attachments, nil
+}
+
+func (s *MysqlStore) ClaimAttachmentPreview(
+	attachmentID string,
+	claimedAt time.Time,
+	staleBefore time.Time,
+) (bool, error) {
+	updateQuery := `
+        UPDATE data_platform_chat_room_attachment_data
+        SET PreviewClaimedAt = ?
+        WHERE AttachmentID = ?
+          AND PreviewStatus IS NULL
+          AND (PreviewClaimedAt IS NULL OR PreviewClaimedAt < ?)
+    `
+	result, err := s.db.Exec(
+		updateQuery,
+		claimedAt.Format("2006-01-02 15:04:05.999999"),
+		attachmentID,
+		staleBefore.Format("2006-01-02 15:04:05.999999"),
+	)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
+
+func (s *MysqlStore) UpdateAttachmentPreview(
+	attachmentID string,
+	previewStatus string,
+	width *int,
+	height *int,
+	previewStorageKey *string,
+	previewMimeType *string,
+) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	updateQuery := `
+        UPDATE data_platform_chat_room_attachment_data
+        SET PreviewStatus = ?,
+            Width = ?,
+            Height = ?,
+            PreviewStorageKey = ?,
+            PreviewMimeType = ?
+        WHERE AttachmentID = ?
+    `
+	_, err = tx.Exec(
+		updateQuery,
+		previewStatus,
+		width,
+		height,
+		previewStorageKey,
+		previewMimeType,
+		attachmentID,
+	)
+	if err != nil {
+		return err
+	}
+
+	var chatRoom string
+	var messageID sql.NullString
+	err = tx.QueryRow(`
+        SELECT ChatRoom, MessageID
+        FROM data_platform_chat_room_attachment_data
+        WHERE AttachmentID = ?
+    `, attachmentID).Scan(&chatRoom, &messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAttachmentMissing
+	} else if err != nil {
+		return err
+	}
+
+	payload := servicesEvents.AttachmentUpdatedPayload{
+		AttachmentID:    attachmentID,
+		PreviewStatus:   previewStatus,
+		Width:           width,
+		Height:          height,
+		PreviewMimeType: previewMimeType,
+	}
+	if messageID.Valid {
+		payload.MessageID = &messageID.String
+	}
+	return insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.AttachmentUpdated,
+		chatRoom,
+		payload,
+	))
+}
+
+func (s *MysqlStore) ReadMessageAttachments(
+	messageIDs []string,
+) (map[string][]typesMessage.Attachment, error) {
+	attachments := make(map[string][]typesMessage.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(messageIDs)-1) + "?"
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM data_platform_chat_room_attachment_data
+        WHERE MessageID IN (` + placeholders + `)
+        ORDER BY CreatedAt ASC
+    `
+	rows, err := s.db.Query(query, toStringInterfaceSlice(messageIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments[*attachment.MessageID] = append(attachments[*attachment.MessageID], *attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (s *MysqlStore) ReadUnlinkedAttachments(
+	createdBefore time.Time,
+	limit int,
+) (*[]typesMessage.Attachment, error) {
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM data_platform_chat_room_attachment_data
+        WHERE MessageID IS NULL
+          AND CreatedAt < ?
+        ORDER BY CreatedAt ASC
+        LIMIT ?
+    `
+	rows, err := s.db.Query(query, createdBefore.Format("2006-01-02 15:04:05.999999"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []typesMessage.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &attachments, nil
+}
+
+func (s *MysqlStore) DeleteUnlinkedAttachment(
+	attachmentID string,
+) (bool, error) {
+	deleteQuery := `
+        DELETE FROM data_platform_chat_room_attachment_data
+        WHERE AttachmentID = ? AND MessageID IS NULL
+    `
+	result, err := s.db.Exec(deleteQuery, attachmentID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// InsertMessageDelivery records that a message reached a device of the
+// participant. It returns false when the delivery was already recorded.
+func (s *MysqlStore) InsertMessageDelivery(
+	messageID string,
+	participant int,
+	deliveredAt string,
+) (bool, error) {
+	insertQuery := `
+        INSERT IGNORE INTO data_platform_chat_room_message_delivery_data (
+            MessageID,
+            Participant,
+            DeliveredAt
+        ) VALUES (?, ?, ?)
+    `
+	result, err := s.db.Exec(insertQuery, messageID, participant, deliveredAt)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted > 0, nil
+}
+
+// MarkChatRoomDelivered records the delivery of every message of the others
+// in the room, up to its latest sequence, that the participant has not
+// received yet. It returns the highest newly delivered sequence per sender.
+// System messages are skipped since nobody waits for their receipts.
+func (s *MysqlStore) MarkChatRoomDelivered(
+	chatRoom string,
+	participant int,
+	deliveredAt string,
+) (map[int]int64, error) {
+	var upTo int64
+	sequenceQuery := `
+        SELECT LastSequence
+        FROM data_platform_chat_room_header_data
+        WHERE ChatRoom = ?
+    `
+	err := s.db.QueryRow(sequenceQuery, chatRoom).Scan(&upTo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChatRoomNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Messages sent after upTo are delivered one by one as they arrive.
+	selectQuery := `
+        SELECT message.BusinessPartner, MAX(message.Sequence)
+        FROM data_platform_chat_room_message_data AS message
+        LEFT JOIN data_platform_chat_room_message_delivery_data AS delivery
+        ON delivery.MessageID = message.MessageID
+           AND delivery.Participant = ?
+        WHERE message.ChatRoom = ?
+          AND message.Sequence <= ?
+          AND message.BusinessPartner <> ?
+          AND message.SenderType <> ?
+          AND delivery.MessageID IS NULL
+        GROUP BY message.BusinessPartner
+    `
+	rows, err := s.db.Query(
+		selectQuery,
+		participant,
+		chatRoom,
+		upTo,
+		participant,
+		typesMessage.SenderTypeSystem,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivered := make(map[int]int64)
+	for rows.Next() {
+		var sender int
+		var sequence int64
+		if err := rows.Scan(&sender, &sequence); err != nil {
+			return nil, err
+		}
+		delivered[sender] = sequence
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(delivered) == 0 {
+		return delivered, nil
+	}
+
+	insertQuery := `
+        INSERT IGNORE INTO data_platform_chat_room_message_delivery_data (
+            MessageID,
+            Participant,
+            DeliveredAt
+        )
+        SELECT MessageID, ?, ?
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ?
+          AND Sequence <= ?
+          AND BusinessPartner <> ?
+          AND SenderType <> ?
+    `
+	_, err = s.db.Exec(
+		insertQuery,
+		participant,
+		deliveredAt,
+		chatRoom,
+		upTo,
+		participant,
+		typesMessage.SenderTypeSystem,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return delivered, nil
+}
+
+func (s *MysqlStore) ReadMessageDeliveries(
+	messageIDs []string,
+) (map[string][]typesMessage.MessageDelivery, error) {
+	deliveries := make(map[string][]typesMessage.MessageDelivery)
+	if len(messageIDs) == 0 {
+		return deliveries, nil
+	}
 
-	tx, err := db.Begin()
+	placeholders := strings.Repeat("?,", len(messageIDs)-1) + "?"
+	query := `
+        SELECT
+            MessageID,
+            Participant,
+            CONCAT(DATE_FORMAT(DeliveredAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(DeliveredAt) / 1000), 3, '0')) AS DeliveredAt
+        FROM data_platform_chat_room_message_delivery_data
+        WHERE MessageID IN (` + placeholders + `)
+        ORDER BY DeliveredAt ASC
+    `
+	rows, err := s.db.Query(query, toStringInterfaceSlice(messageIDs)...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var delivery typesMessage.MessageDelivery
+		if err := rows.Scan(&messageID, &delivery.Participant, &delivery.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries[messageID] = append(deliveries[messageID], delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateReadWatermark moves the read-up-to watermark of the participant to
+// messageID. Watermarks never move backwards; the second return value tells
+// whether this call advanced it.
+func (s *MysqlStore) UpdateReadWatermark(
+	chatRoom string,
+	participant int,
+	messageID string,
+	readAt string,
+) (watermark *typesMessage.ReadWatermark, advanced bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
 	defer func() {
 		if err != nil {
 			tx.Rollback()
@@ -41,140 +1788,119 @@ func CreateChatRoom(
 		err = tx.Commit()
 	}()
 
-	checkQuery := `
-        SELECT ChatRoom
-        FROM data_platform_chat_room_header_data
-        WHERE (RoomCreator = ? AND RoomPartner = ?)
-           OR (RoomCreator = ? AND RoomPartner = ?)
+	// %f keeps microseconds with a fixed width, so the strings compare in
+	// chronological order.
+	var sentAt string
+	messageQuery := `
+        SELECT DATE_FORMAT(SentAt, '%Y-%m-%d %H:%i:%s.%f')
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ?
     `
-	var existingRoomID string
-	err = tx.QueryRow(
-		checkQuery,
-		roomCreator,
-		roomPartner,
-		roomPartner,
-		roomCreator,
-	).Scan(&existingRoomID)
-	if err == nil {
-		return &existingRoomID, nil
-	} else if !errors.Is(err, sql.ErrNoRows) {
-		return nil, err
+	err = tx.QueryRow(messageQuery, chatRoom, messageID).Scan(&sentAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrMessageNotFound
+		return nil, false, err
+	} else if err != nil {
+		return nil, false, err
 	}
 
-	insertQuery := `
-        INSERT INTO data_platform_chat_room_header_data (
+	var currentSentAt string
+	var currentMessageID string
+	watermarkQuery := `
+        SELECT DATE_FORMAT(LastReadSentAt, '%Y-%m-%d %H:%i:%s.%f'), LastReadMessageID
+        FROM data_platform_chat_room_read_watermark_data
+        WHERE ChatRoom = ? AND Participant = ?
+        FOR UPDATE
+    `
+	err = tx.QueryRow(watermarkQuery, chatRoom, participant).Scan(&currentSentAt, &currentMessageID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+	found := err == nil
+	err = nil
+
+	if found && (sentAt < currentSentAt || (sentAt == currentSentAt && messageID <= currentMessageID)) {
+		return nil, false, nil
+	}
+
+	upsertQuery := `
+        INSERT INTO data_platform_chat_room_read_watermark_data (
             ChatRoom,
-            RoomCreator,
-            RoomPartner,
-            CreatedAt,
-            UpdatedAt
+            Participant,
+            LastReadSentAt,
+            LastReadMessageID,
+            ReadAt
         ) VALUES (?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            LastReadSentAt = VALUES(LastReadSentAt),
+            LastReadMessageID = VALUES(LastReadMessageID),
+            ReadAt = VALUES(ReadAt)
     `
+	_, err = tx.Exec(upsertQuery, chatRoom, participant, sentAt, messageID, readAt)
+	if err != nil {
+		return nil, false, err
+	}
 
-	_, err = tx.Exec(
-		insertQuery,
+	err = insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.MessageRead,
 		chatRoom,
-		roomCreator,
-		roomPartner,
-		now,
-		now,
-	)
-
+		servicesEvents.MessageReadPayload{
+			MessageID: messageID,
+			Reader:    participant,
+			ReadAt:    readAt,
+			UpTo:      true,
+		},
+	))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return &chatRoom, nil
+	return &typesMessage.ReadWatermark{
+		Participant: participant,
+		MessageID:   messageID,
+		SentAt:      sentAt,
+		ReadAt:      readAt,
+	}, true, nil
 }
 
-func ReadConversationHistoryWithReadStatus(
-	db *database.Mysql,
+func (s *MysqlStore) ReadReadWatermarks(
 	chatRoom string,
-) (*[]typesMessage.ConversationHistoryWithReadStatus, error) {
+) (*[]typesMessage.ReadWatermark, error) {
 	query := `
-        SELECT 
-            message.MessageID, 
-            message.ChatRoom, 
-            message.BusinessPartner, 
-            message.Content, 
-            CONCAT(DATE_FORMAT(message.SentAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(message.SentAt) / 1000), 3, '0')) AS SentAt,
-            messageReadStatus.ReadStatusID,
-            CONCAT(DATE_FORMAT(messageReadStatus.ReadAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(messageReadStatus.ReadAt) / 1000), 3, '0')) AS ReadAt
-        FROM 
-            data_platform_chat_room_message_data AS message
-        LEFT JOIN 
-            data_platform_chat_room_message_read_status_data AS messageReadStatus
-        ON 
-            message.MessageID = messageReadStatus.MessageID
-        WHERE 
-            message.ChatRoom = ?
+        SELECT
+            Participant,
+            LastReadMessageID,
+            DATE_FORMAT(LastReadSentAt, '%Y-%m-%d %H:%i:%s.%f') AS LastReadSentAt,
+            CONCAT(DATE_FORMAT(ReadAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(ReadAt) / 1000), 3, '0')) AS ReadAt
+        FROM data_platform_chat_room_read_watermark_data
+        WHERE ChatRoom = ?
     `
-	rows, err := db.Query(query, chatRoom)
+	rows, err := s.db.Query(query, chatRoom)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var histories []typesMessage.ConversationHistoryWithReadStatus
+	var watermarks []typesMessage.ReadWatermark
 	for rows.Next() {
-		var history typesMessage.ConversationHistoryWithReadStatus
-		var readStatusID sql.NullString
-		var readAt sql.NullString
-
+		var watermark typesMessage.ReadWatermark
 		if err := rows.Scan(
-			&history.MessageID,
-			&history.ChatRoom,
-			&history.BusinessPartner,
-			&history.Content,
-			&history.SentAt,
-			&readStatusID,
-			&readAt,
+			&watermark.Participant,
+			&watermark.MessageID,
+			&watermark.SentAt,
+			&watermark.ReadAt,
 		); err != nil {
 			return nil, err
 		}
-
-		if readStatusID.Valid {
-			history.ReadStatusID = &readStatusID.String
-		}
-		if readAt.Valid {
-			history.ReadAt = &readAt.String
-		}
-
-		histories = append(histories, history)
+		watermarks = append(watermarks, watermark)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return &histories, nil
-}
-
-func InsertConversationHistory(
-	db *database.Mysql,
-	chatRoom string,
-	businessPartner int,
-	messageID string,
-	message string,
-	sentAt string,
-) error {
-	insertQuery := `
-        INSERT INTO data_platform_chat_room_message_data (
-            MessageID,
-            ChatRoom,
-            BusinessPartner,
-            Content,
-            SentAt
-        ) VALUES (?, ?, ?, ?, ?)
-    `
-	_, err := db.Exec(insertQuery, messageID, chatRoom, businessPartner, message, sentAt)
-	if err != nil {
-		return err
-	}
-
-	return err
+	return &watermarks, nil
 }
 
-func ReadBusinessPartnerDocs(
-	db *database.Mysql,
+func (s *MysqlStore) ReadBusinessPartnerDocs(
 	businessPartners []int,
 ) (*[]BusinessPartnerDoc, error) {
 	placeholders := strings.Repeat("?,", len(businessPartners)-1) + "?"
@@ -185,7 +1911,7 @@ func ReadBusinessPartnerDocs(
         WHERE BusinessPartner IN (` + placeholders + `)
     `
 
-	rows, err := db.Query(query, toInterfaceSlice(businessPartners)...)
+	rows, err := s.db.Query(query, toInterfaceSlice(businessPartners)...)
 	if err != nil {
 		return nil, err
 	}
@@ -215,13 +1941,41 @@ func ReadBusinessPartnerDocs(
 	return &docs, nil
 }
 
-func InsertMessageReadStatus(
-	db *database.Mysql,
+// InsertMessageReadStatus records that participant read a message of the
+// room and returns the sender of the message. Messages of other rooms are
+// reported as ErrMessageNotFound.
+func (s *MysqlStore) InsertMessageReadStatus(
+	chatRoom string,
 	readStatusID string,
 	messageID string,
 	participant int,
 	readAt string,
-) error {
+) (sender int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	selectQuery := `
+        SELECT BusinessPartner
+        FROM data_platform_chat_room_message_data
+        WHERE ChatRoom = ? AND MessageID = ?
+    `
+	err = tx.QueryRow(selectQuery, chatRoom, messageID).Scan(&sender)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrMessageNotFound
+		return 0, err
+	} else if err != nil {
+		return 0, err
+	}
+
 	insertQuery := `
         INSERT INTO data_platform_chat_room_message_read_status_data (
             ReadStatusID,
@@ -230,16 +1984,29 @@ func InsertMessageReadStatus(
             ReadAt
         ) VALUES (?, ?, ?, ?)
     `
-	_, err := db.Exec(insertQuery, readStatusID, messageID, participant, readAt)
+	_, err = tx.Exec(insertQuery, readStatusID, messageID, participant, readAt)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	err = insertOutboxEvent(tx, servicesEvents.NewEvent(
+		servicesEvents.MessageRead,
+		chatRoom,
+		servicesEvents.MessageReadPayload{
+			MessageID:    messageID,
+			Reader:       participant,
+			ReadAt:       readAt,
+			ReadStatusID: &readStatusID,
+		},
+	))
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return sender, nil
 }
 
-func ReadBusinessPartnerWithDetails(
-	db *database.Mysql,
+func (s *MysqlStore) ReadBusinessPartnerWithDetails(
 	businessPartnerID int,
 ) (*[]typesMessage.BusinessPartnerWithDetails, error) {
 	query := `
@@ -272,7 +2039,7 @@ func ReadBusinessPartnerWithDetails(
             bp.BusinessPartner = ?
     `
 
-	rows, err := db.Query(query, businessPartnerID)
+	rows, err := s.db.Query(query, businessPartnerID)
 	if err != nil {
 		return nil, err
 	}
@@ -319,6 +2086,57 @@ func ReadBusinessPartnerWithDetails(
 	return &partners, nil
 }
 
+func (s *MysqlStore) UpsertLastSeen(
+	businessPartner int,
+	lastSeenAt string,
+) error {
+	upsertQuery := `
+        INSERT INTO data_platform_chat_presence_data (
+            BusinessPartner,
+            LastSeenAt
+        ) VALUES (?, ?)
+        ON DUPLICATE KEY UPDATE LastSeenAt = VALUES(LastSeenAt)
+    `
+	_, err := s.db.Exec(upsertQuery, businessPartner, lastSeenAt)
+	return err
+}
+
+func (s *MysqlStore) ReadLastSeen(
+	businessPartners []int,
+) (map[int]string, error) {
+	lastSeen := make(map[int]string)
+	if len(businessPartners) == 0 {
+		return lastSeen, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(businessPartners)-1) + "?"
+	query := `
+        SELECT
+            BusinessPartner,
+            CONCAT(DATE_FORMAT(LastSeenAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(LastSeenAt) / 1000), 3, '0')) AS LastSeenAt
+        FROM data_platform_chat_presence_data
+        WHERE BusinessPartner IN (` + placeholders + `)
+    `
+	rows, err := s.db.Query(query, toInterfaceSlice(businessPartners)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var businessPartner int
+		var lastSeenAt string
+		if err := rows.Scan(&businessPartner, &lastSeenAt); err != nil {
+			return nil, err
+		}
+		lastSeen[businessPartner] = lastSeenAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lastSeen, nil
+}
+
 func toInterfaceSlice(ints []int) []interface{} {
 	interfaces := make([]interface{}, len(ints))
 	for i, v := range ints {
@@ -326,3 +2144,243 @@ func toInterfaceSlice(ints []int) []interface{} {
 	}
 	return interfaces
 }
+
+func toStringInterfaceSlice(strs []string) []interface{} {
+	interfaces := make([]interface{}, len(strs))
+	for i, v := range strs {
+		interfaces[i] = v
+	}
+	return interfaces
+}
+
+func parseIntList(commaSeparated string) ([]int, error) {
+	var ints []int
+	for _, v := range strings.Split(commaSeparated, ",") {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// insertOutboxEvent stores the event in the transaction that made the change
+// it describes. The outbox relay publishes it after the commit.
+func insertOutboxEvent(tx *sql.Tx, event servicesEvents.Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+        INSERT INTO data_platform_chat_room_outbox_data (
+            EventID,
+            EventType,
+            Version,
+            ChatRoom,
+            Payload,
+            OccurredAt,
+            NextAttemptAt
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err = tx.Exec(
+		insertQuery,
+		event.EventID,
+		event.Type,
+		event.Version,
+		event.ChatRoom,
+		string(payload),
+		event.OccurredAt,
+		event.OccurredAt,
+	)
+	return err
+}
+
+// ProcessOutboxEvents publishes up to limit due outbox events in the order
+// they were written. Rows are claimed with SKIP LOCKED, so relays on several
+// pods never publish the same row at once. A failed event is retried after
+// backoff(attempts); it returns the number of events published.
+func (s *MysqlStore) ProcessOutboxEvents(
+	limit int,
+	publish func(event servicesEvents.Event) error,
+	backoff func(attempts int) time.Duration,
+) (published int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	now := time.Now()
+	selectQuery := `
+        SELECT
+            OutboxID,
+            EventID,
+            EventType,
+            Version,
+            ChatRoom,
+            Payload,
+            DATE_FORMAT(OccurredAt, '%Y-%m-%d %H:%i:%s.%f'),
+            Attempts
+        FROM data_platform_chat_room_outbox_data
+        WHERE PublishedAt IS NULL
+          AND NextAttemptAt <= ?
+        ORDER BY OutboxID ASC
+        LIMIT ?
+        FOR UPDATE SKIP LOCKED
+    `
+	rows, err := tx.Query(selectQuery, now.Format("2006-01-02 15:04:05.999999"), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type outboxRow struct {
+		outboxID int64
+		event    servicesEvents.Event
+		attempts int
+	}
+	var pending []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		var payload string
+		err = rows.Scan(
+			&row.outboxID,
+			&row.event.EventID,
+			&row.event.Type,
+			&row.event.Version,
+			&row.event.ChatRoom,
+			&payload,
+			&row.event.OccurredAt,
+			&row.attempts,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		row.event.Payload = json.RawMessage(payload)
+		pending = append(pending, row)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, row := range pending {
+		publishErr := publish(row.event)
+		if publishErr == nil {
+			_, err = tx.Exec(`
+                UPDATE data_platform_chat_room_outbox_data
+                SET PublishedAt = ?, Attempts = Attempts + 1, LastError = NULL
+                WHERE OutboxID = ?
+            `, time.Now().Format("2006-01-02 15:04:05.999999"), row.outboxID)
+			if err != nil {
+				return published, err
+			}
+			published++
+			continue
+		}
+
+		nextAttemptAt := time.Now().Add(backoff(row.attempts + 1))
+		_, err = tx.Exec(`
+            UPDATE data_platform_chat_room_outbox_data
+            SET Attempts = Attempts + 1, NextAttemptAt = ?, LastError = ?
+            WHERE OutboxID = ?
+        `, nextAttemptAt.Format("2006-01-02 15:04:05.999999"), publishErr.Error(), row.outboxID)
+		if err != nil {
+			return published, err
+		}
+	}
+
+	return published, err
+}
+
+// DeletePublishedOutboxEvents removes events published before the given
+// time, keeping the outbox table small.
+func (s *MysqlStore) DeletePublishedOutboxEvents(
+	before time.Time,
+) error {
+	deleteQuery := `
+        DELETE FROM data_platform_chat_room_outbox_data
+        WHERE PublishedAt IS NOT NULL AND PublishedAt < ?
+    `
+	_, err := s.db.Exec(deleteQuery, before.Format("2006-01-02 15:04:05.999999"))
+	return err
+}
+
+// ReadOutboxBacklog summarises the events still waiting to be published and
+// lists the oldest of them.
+func (s *MysqlStore) ReadOutboxBacklog(
+	limit int,
+) (*typesMessage.OutboxBacklog, error) {
+	var backlog typesMessage.OutboxBacklog
+	var oldestPendingAt sql.NullString
+	summaryQuery := `
+        SELECT
+            COUNT(*),
+            COALESCE(SUM(Attempts > 0), 0),
+            CONCAT(DATE_FORMAT(MIN(OccurredAt), '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(MIN(OccurredAt)) / 1000), 3, '0'))
+        FROM data_platform_chat_room_outbox_data
+        WHERE PublishedAt IS NULL
+    `
+	err := s.db.QueryRow(summaryQuery).Scan(&backlog.Pending, &backlog.Retrying, &oldestPendingAt)
+	if err != nil {
+		return nil, err
+	}
+	if oldestPendingAt.Valid {
+		backlog.OldestPendingAt = &oldestPendingAt.String
+	}
+
+	query := `
+        SELECT
+            OutboxID,
+            EventID,
+            EventType,
+            ChatRoom,
+            CONCAT(DATE_FORMAT(OccurredAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(OccurredAt) / 1000), 3, '0')),
+            Attempts,
+            CONCAT(DATE_FORMAT(NextAttemptAt, '%Y-%m-%d %H:%i:%s'),'.',LPAD(FLOOR(MICROSECOND(NextAttemptAt) / 1000), 3, '0')),
+            LastError
+        FROM data_platform_chat_room_outbox_data
+        WHERE PublishedAt IS NULL
+        ORDER BY OutboxID ASC
+        LIMIT ?
+    `
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backlog.Events = []typesMessage.OutboxEvent{}
+	for rows.Next() {
+		var event typesMessage.OutboxEvent
+		var lastError sql.NullString
+		if err := rows.Scan(
+			&event.OutboxID,
+			&event.EventID,
+			&event.EventType,
+			&event.ChatRoom,
+			&event.OccurredAt,
+			&event.Attempts,
+			&event.NextAttemptAt,
+			&lastError,
+		); err != nil {
+			return nil, err
+		}
+		if lastError.Valid {
+			event.LastError = &lastError.String
+		}
+		backlog.Events = append(backlog.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &backlog, nil
+}
@@ -0,0 +1,92 @@
+package servicesStorage
+
+import (
+	"data-platform-conversation-kube/services"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"time"
+)
+
+const (
+	cleanupInterval  = time.Hour
+	cleanupBatchSize = 100
+)
+
+// Cleaner deletes uploads that were never sent with a message, together
+// with their blobs, once they are older than the TTL. Cleaners on several
+// pods may run at once: only the one whose delete removed the row deletes
+// the blobs.
+type Cleaner struct {
+	store        services.AttachmentStore
+	storage      Storage
+	customLogger *logger.Logger
+	ttl          time.Duration
+}
+
+func NewCleaner(
+	store services.AttachmentStore,
+	storage Storage,
+	l *logger.Logger,
+	ttl time.Duration,
+) *Cleaner {
+	return &Cleaner{
+		store:        store,
+		storage:      storage,
+		customLogger: l,
+		ttl:          ttl,
+	}
+}
+
+func (c *Cleaner) Start() {
+	go c.run()
+}
+
+func (c *Cleaner) run() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		c.clean(time.Now().Add(-c.ttl))
+	}
+}
+
+// clean deletes the unlinked attachments created before createdBefore and
+// returns how many it deleted. It stops at the first store error and
+// leaves the rest to the next run.
+func (c *Cleaner) clean(createdBefore time.Time) int {
+	deleted := 0
+	for {
+		attachments, err := c.store.ReadUnlinkedAttachments(createdBefore, cleanupBatchSize)
+		if err != nil {
+			c.customLogger.Error("ReadUnlinkedAttachments error: %v", err)
+			return deleted
+		}
+
+		for _, attachment := range *attachments {
+			// The row goes first, so a message sent meanwhile never links
+			// an attachment whose blob is gone.
+			removed, err := c.store.DeleteUnlinkedAttachment(attachment.AttachmentID)
+			if err != nil {
+				c.customLogger.Error("DeleteUnlinkedAttachment error: %v", err)
+				return deleted
+			}
+			if !removed {
+				continue
+			}
+			deleted++
+
+			keys := []string{attachment.StorageKey}
+			if attachment.PreviewStorageKey != nil {
+				keys = append(keys, *attachment.PreviewStorageKey)
+			}
+			for _, key := range keys {
+				if err := c.storage.Delete(key); err != nil {
+					c.customLogger.Error("Failed to delete blob %s of attachment %s: %v", key, attachment.AttachmentID, err)
+				}
+			}
+		}
+
+		if len(*attachments) < cleanupBatchSize {
+			return deleted
+		}
+	}
+}
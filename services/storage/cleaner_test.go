@@ -0,0 +1,94 @@
+package servicesStorage
+
+import (
+	"data-platform-conversation-kube/services"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"errors"
+	"github.com/latonaio/golang-logging-library-for-data-platform/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanerDeletesOldUnlinkedAttachments(t *testing.T) {
+	store := services.NewMemoryStore()
+	chatRoom, _, err := store.CreateChatRoom(1001, 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(key string) {
+		t.Helper()
+		if err := storage.Put(key, strings.NewReader(key), int64(len(key)), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload := func(attachmentID string, age time.Duration) typesMessage.Attachment {
+		t.Helper()
+		attachment := typesMessage.Attachment{
+			AttachmentID: attachmentID,
+			ChatRoom:     *chatRoom,
+			Uploader:     1001,
+			FileName:     attachmentID + ".png",
+			MimeType:     "image/png",
+			Size:         1,
+			StorageKey:   *chatRoom + "/" + attachmentID,
+			CreatedAt:    time.Now().Add(-age).Format("2006-01-02 15:04:05.999999"),
+		}
+		put(attachment.StorageKey)
+		if err := store.InsertAttachment(attachment); err != nil {
+			t.Fatal(err)
+		}
+		return attachment
+	}
+
+	abandoned := upload("abandoned", 2*time.Hour)
+	previewKey := abandoned.StorageKey + ".preview.png"
+	put(previewKey)
+	previewMimeType := "image/png"
+	err = store.UpdateAttachmentPreview("abandoned", typesMessage.PreviewStatusReady, nil, nil, &previewKey, &previewMimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := upload("sent", 2*time.Hour)
+	_, _, err = store.InsertConversationHistory(
+		*chatRoom,
+		1001,
+		typesMessage.SenderTypeBusinessPartner,
+		"m1",
+		"see attached",
+		time.Now().Format("2006-01-02 15:04:05.999999"),
+		nil,
+		[]string{"sent"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := upload("recent", time.Minute)
+
+	cleaner := NewCleaner(store, storage, logger.NewLogger(), time.Hour)
+	if deleted := cleaner.clean(time.Now().Add(-cleaner.ttl)); deleted != 1 {
+		t.Errorf("clean() = %d, want 1", deleted)
+	}
+
+	if _, err := store.ReadAttachment(*chatRoom, "abandoned"); !errors.Is(err, services.ErrAttachmentMissing) {
+		t.Errorf("ReadAttachment(abandoned) error = %v, want ErrAttachmentMissing", err)
+	}
+	for _, key := range []string{abandoned.StorageKey, previewKey} {
+		if _, err := storage.Get(key); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Get(%s) error = %v, want ErrObjectNotFound", key, err)
+		}
+	}
+	for _, kept := range []typesMessage.Attachment{sent, recent} {
+		if _, err := store.ReadAttachment(*chatRoom, kept.AttachmentID); err != nil {
+			t.Errorf("ReadAttachment(%s) error = %v", kept.AttachmentID, err)
+		}
+		if got := read(t, storage, kept.StorageKey); got != kept.StorageKey {
+			t.Errorf("Get(%s) = %q", kept.StorageKey, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package servicesStorage
+
+import (
+	"errors"
+	"golang.org/x/xerrors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type FilesystemStorage struct {
+	directory string
+}
+
+func NewFilesystemStorage(directory string) (*FilesystemStorage, error) {
+	if err := os.MkdirAll(directory, 0o750); err != nil {
+		return nil, xerrors.Errorf("create attachment directory error: %w", err)
+	}
+	return &FilesystemStorage{
+		directory: directory,
+	}, nil
+}
+
+func (s *FilesystemStorage) Put(key string, body io.Reader, _ int64, _ string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial blob.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FilesystemStorage) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (s *FilesystemStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FilesystemStorage) path(key string) string {
+	return filepath.Join(s.directory, filepath.FromSlash(filepath.Clean("/"+key)))
+}
@@ -0,0 +1,87 @@
+package servicesStorage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func read(t *testing.T, storage *FilesystemStorage, key string) string {
+	t.Helper()
+
+	body, err := storage.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestFilesystemStoragePutWritesThroughRename(t *testing.T) {
+	directory := t.TempDir()
+	storage, err := NewFilesystemStorage(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := storage.Put("room/a1", strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		if got := read(t, storage, "room/a1"); got != content {
+			t.Errorf("Get() = %q, want %q", got, content)
+		}
+	}
+
+	// Only the renamed blob is left; no temporary upload files.
+	entries, err := os.ReadDir(filepath.Join(directory, "room"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a1" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("directory holds %v, want only a1", names)
+	}
+}
+
+func TestFilesystemStorageKeepsKeysInsideDirectory(t *testing.T) {
+	directory := t.TempDir()
+	storage, err := NewFilesystemStorage(filepath.Join(directory, "attachments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Put("../escaped", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "escaped")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("blob was written outside the storage directory: %v", err)
+	}
+	if got := read(t, storage, "escaped"); got != "x" {
+		t.Errorf("Get() = %q, want x", got)
+	}
+}
+
+func TestFilesystemStorageMissingKey(t *testing.T) {
+	storage, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.Get("room/missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get() error = %v, want ErrObjectNotFound", err)
+	}
+	if err := storage.Delete("room/missing"); err != nil {
+		t.Errorf("Delete() error = %v, want none", err)
+	}
+}
@@ -0,0 +1,72 @@
+package servicesStorage
+
+import (
+	"context"
+	"data-platform-conversation-kube/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+// S3Storage stores blobs in any S3-compatible object storage.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Storage(conf *config.ATTACHMENT) (*S3Storage, error) {
+	client, err := minio.New(conf.S3Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.S3AccessKey(), conf.S3SecretKey(), ""),
+		Secure: conf.S3UseSSL(),
+		Region: conf.S3Region(),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("s3 client error: %w", err)
+	}
+
+	exists, err := client.BucketExists(context.Background(), conf.S3Bucket())
+	if err != nil {
+		return nil, xerrors.Errorf("s3 bucket check error: %w", err)
+	}
+	if !exists {
+		return nil, xerrors.Errorf("s3 bucket %s does not exist", conf.S3Bucket())
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: conf.S3Bucket(),
+	}, nil
+}
+
+func (s *S3Storage) Put(key string, body io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(
+		context.Background(),
+		s.bucket,
+		key,
+		body,
+		size,
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	return err
+}
+
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before streaming.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{})
+}
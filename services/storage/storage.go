@@ -0,0 +1,27 @@
+package servicesStorage
+
+import (
+	"data-platform-conversation-kube/config"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+var ErrObjectNotFound = xerrors.New("object not found")
+
+// Storage keeps attachment blobs by key. Keys are generated by the service and
+// never come from clients.
+type Storage interface {
+	Put(key string, body io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+func NewStorage(conf *config.ATTACHMENT) (Storage, error) {
+	switch conf.Storage() {
+	case config.StorageFilesystem:
+		return NewFilesystemStorage(conf.Directory())
+	case config.StorageS3:
+		return NewS3Storage(conf)
+	}
+	return nil, xerrors.Errorf("unknown attachment storage: %s", conf.Storage())
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	servicesEvents "data-platform-conversation-kube/services/events"
+	typesMessage "data-platform-conversation-kube/types/message"
+	"time"
+)
+
+// ConversationStore is everything the service persists. MysqlStore is used
+// in production; MemoryStore keeps the same semantics in process for tests
+// and local development.
+type ConversationStore interface {
+	RoomStore
+	MessageStore
+	ReadStatusStore
+	AttachmentStore
+	ProfileStore
+	OutboxStore
+}
+
+type RoomStore interface {
+	CreateChatRoom(roomCreator int, roomPartner int) (*string, bool, error)
+	CreateGroupChatRoom(roomCreator int, participants []int, title string) (*string, error)
+	IsChatRoomMember(chatRoom string, businessPartner int) (bool, error)
+	SharesChatRoom(businessPartner int, counterpart int) (bool, error)
+	CounterpartsSharingChatRoom(businessPartner int, counterparts []int) (map[int]bool, error)
+	ReadChatRooms(businessPartner int, ascending bool, limit int, offset int) (*[]typesMessage.ChatRoomSummary, error)
+	ReadChatRoomIDs(businessPartner int) ([]string, error)
+	ReadChatRoomsMembers(chatRooms []string) (map[string][]int, error)
+}
+
+type MessageStore interface {
+	ReadConversationHistoryWithReadStatus(
+		chatRoom string,
+		viewer int,
+		before *typesMessage.HistoryCursor,
+		after *typesMessage.HistoryCursor,
+		limit int,
+	) (*[]typesMessage.ConversationHistoryWithReadStatus, *typesMessage.HistoryCursor, error)
+	InsertConversationHistory(
+		chatRoom string,
+		businessPartner int,
+		senderType string,
+		messageID string,
+		message string,
+		sentAt string,
+		replyTo *string,
+		attachmentIDs []string,
+	) (*typesMessage.MessageAccepted, bool, error)
+	ReadMessagesAfterSequence(chatRoom string, viewer int, afterSequence int64, limit int) (*[]typesMessage.SequencedMessage, error)
+	EditMessage(
+		chatRoom string,
+		messageID string,
+		editor int,
+		content string,
+		editedAt time.Time,
+		editWindow time.Duration,
+	) error
+	DeleteMessageForEveryone(chatRoom string, messageID string, businessPartner int, deletedAt string) error
+	DeleteMessageForSelf(chatRoom string, messageID string, businessPartner int, deletedAt string) error
+	ReadMessageRevisions(messageIDs []string) (map[string][]typesMessage.MessageRevision, error)
+	AddReaction(chatRoom string, messageID string, businessPartner int, emoji string, reactedAt string) error
+	RemoveReaction(chatRoom string, messageID string, businessPartner int, emoji string) error
+	ReadMessageReactions(messageIDs []string) (map[string][]typesMessage.ReactionCount, error)
+}
+
+type ReadStatusStore interface {
+	InsertMessageReadStatus(chatRoom string, readStatusID string, messageID string, participant int, readAt string) (int, error)
+	UpdateReadWatermark(chatRoom string, participant int, messageID string, readAt string) (*typesMessage.ReadWatermark, bool, error)
+	ReadReadWatermarks(chatRoom string) (*[]typesMessage.ReadWatermark, error)
+	InsertMessageDelivery(messageID string, participant int, deliveredAt string) (bool, error)
+	MarkChatRoomDelivered(chatRoom string, participant int, deliveredAt string) (map[int]int64, error)
+	ReadMessageDeliveries(messageIDs []string) (map[string][]typesMessage.MessageDelivery, error)
+}
+
+type AttachmentStore interface {
+	InsertAttachment(attachment typesMessage.Attachment) error
+	ReadAttachment(chatRoom string, attachmentID string) (*typesMessage.Attachment, error)
+	// ClaimPendingPreviewAttachments takes up to limit attachments of the
+	// given types that have no preview yet and are not claimed since
+	// staleBefore, so a claim left by a pod that died is taken over.
+	ClaimPendingPreviewAttachments(
+		mimeTypes []string,
+		limit int,
+		claimedAt time.Time,
+		staleBefore time.Time,
+	) (*[]typesMessage.Attachment, error)
+	// ClaimAttachmentPreview takes one attachment the same way and reports
+	// whether this call got it.
+	ClaimAttachmentPreview(attachmentID string, claimedAt time.Time, staleBefore time.Time) (bool, error)
+	// UpdateAttachmentPreview also writes an AttachmentUpdated event to the
+	// outbox.
+	UpdateAttachmentPreview(
+		attachmentID string,
+		previewStatus string,
+		width *int,
+		height *int,
+		previewStorageKey *string,
+		previewMimeType *string,
+	) error
+	ReadMessageAttachments(messageIDs []string) (map[string][]typesMessage.Attachment, error)
+	// ReadUnlinkedAttachments lists the oldest uploads created before
+	// createdBefore that were never sent with a message.
+	ReadUnlinkedAttachments(createdBefore time.Time, limit int) (*[]typesMessage.Attachment, error)
+	// DeleteUnlinkedAttachment deletes the attachment unless it has been sent
+	// with a message meanwhile, and reports whether it did.
+	DeleteUnlinkedAttachment(attachmentID string) (bool, error)
+}
+
+type ProfileStore interface {
+	ReadBusinessPartnerDocs(businessPartners []int) (*[]BusinessPartnerDoc, error)
+	ReadBusinessPartnerWithDetails(businessPartnerID int) (*[]typesMessage.BusinessPartnerWithDetails, error)
+	UpsertLastSeen(businessPartner int, lastSeenAt string) error
+	ReadLastSeen(businessPartners []int) (map[int]string, error)
+}
+
+type OutboxStore interface {
+	ProcessOutboxEvents(
+		limit int,
+		publish func(event servicesEvents.Event) error,
+		backoff func(attempts int) time.Duration,
+	) (int, error)
+	DeletePublishedOutboxEvents(before time.Time) error
+	ReadOutboxBacklog(limit int) (*typesMessage.OutboxBacklog, error)
+}
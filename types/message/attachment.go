@@ -0,0 +1,28 @@
+package typesMessage
+
+type Attachment struct {
+	AttachmentID string
+	ChatRoom     string
+	MessageID    *string
+	Uploader     int
+	FileName     string
+	MimeType     string
+	Size         int64
+	StorageKey   string `json:"-"`
+	CreatedAt    string
+	URL          string
+
+	// Previews are generated in the background for images, so these stay nil
+	// until PreviewStatus is Ready.
+	Width             *int
+	Height            *int
+	PreviewStatus     *string
+	PreviewStorageKey *string `json:"-"`
+	PreviewMimeType   *string
+	PreviewURL        *string
+}
+
+const (
+	PreviewStatusReady  = "Ready"
+	PreviewStatusFailed = "Failed"
+)
@@ -0,0 +1,29 @@
+package typesMessage
+
+const (
+	RoomTypeDirect = "Direct"
+	RoomTypeGroup  = "Group"
+)
+
+type CreatesGroupRequest struct {
+	BusinessPartners []int  `json:"BusinessPartners"`
+	Title            string `json:"Title"`
+}
+
+type LastMessage struct {
+	MessageID       string
+	BusinessPartner int
+	Content         string
+	SentAt          string
+}
+
+type ChatRoomSummary struct {
+	ChatRoom       string
+	RoomType       string
+	Title          *string
+	CreatedAt      string
+	LastActivityAt string
+	LastMessage    *LastMessage
+	UnreadCount    int
+	Counterparts   []BusinessPartnerWithDetails
+}
@@ -1,11 +1,84 @@
 package typesMessage
 
 type ConversationHistoryWithReadStatus struct {
+	MessageID        string
+	ChatRoom         string
+	BusinessPartner  int
+	SenderType       string
+	ReplyTo          *string
+	Sequence         int64
+	Content          string
+	SentAt           string
+	EditedAt         *string
+	DeletedAt        *string
+	ReadParticipants []int
+	ReadStatusID     *string
+	ReadBy           *int
+	ReadAt           *string
+	Revisions        []MessageRevision `json:",omitempty"`
+	Reactions        []ReactionCount   `json:",omitempty"`
+	Attachments      []Attachment      `json:",omitempty"`
+	Deliveries       []MessageDelivery `json:",omitempty"`
+}
+
+// MessageAccepted acknowledges a stored message to its sender with the
+// server-assigned SentAt and sequence.
+type MessageAccepted struct {
+	MessageID string
+	ChatRoom  string
+	SentAt    string
+	Sequence  int64
+}
+
+// SequencedMessage is a message as replayed to a reconnecting client.
+type SequencedMessage struct {
 	MessageID       string
 	ChatRoom        string
 	BusinessPartner int
+	SenderType      string
+	ReplyTo         *string
 	Content         string
 	SentAt          string
-	ReadStatusID    *string
-	ReadAt          *string
+	EditedAt        *string
+	DeletedAt       *string
+	Sequence        int64
+}
+
+// ReadWatermark marks every message up to and including MessageID as read by
+// Participant.
+type ReadWatermark struct {
+	Participant int
+	MessageID   string
+	SentAt      string
+	ReadAt      string
+}
+
+type MessageDelivery struct {
+	Participant int
+	DeliveredAt string
+}
+
+type ReactionCount struct {
+	Emoji            string
+	Count            int
+	BusinessPartners []int
 }
+
+type MessageRevision struct {
+	RevisionID string
+	MessageID  string
+	Content    string
+	EditedAt   string
+}
+
+const (
+	DeleteScopeSelf     = "self"
+	DeleteScopeEveryone = "everyone"
+)
+
+// SenderType tells messages written by a business partner apart from system
+// messages posted by other services, whose BusinessPartner is 0.
+const (
+	SenderTypeBusinessPartner = "BusinessPartner"
+	SenderTypeSystem          = "System"
+)
@@ -0,0 +1,8 @@
+package typesMessage
+
+// HistoryCursor points at a single message by the full precision SentAt and
+// the MessageID that breaks ties between messages sent at the same time.
+type HistoryCursor struct {
+	SentAt    string
+	MessageID string
+}
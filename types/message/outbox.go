@@ -0,0 +1,21 @@
+package typesMessage
+
+// OutboxBacklog describes the events written to the outbox that have not
+// been published yet.
+type OutboxBacklog struct {
+	Pending         int
+	Retrying        int
+	OldestPendingAt *string
+	Events          []OutboxEvent
+}
+
+type OutboxEvent struct {
+	OutboxID      int64
+	EventID       string
+	EventType     string
+	ChatRoom      string
+	OccurredAt    string
+	Attempts      int
+	NextAttemptAt string
+	LastError     *string
+}
@@ -0,0 +1,12 @@
+package typesMessage
+
+const (
+	PresenceOnline  = "Online"
+	PresenceOffline = "Offline"
+)
+
+type Presence struct {
+	BusinessPartner int
+	Status          string
+	LastSeenAt      *string
+}